@@ -11,7 +11,7 @@ import (
 )
 
 type Commit struct {
-	Info    Header
+	Info    Header // signed info of the commit (see WithMessage)
 	Headers []Header
 	Body    io.ReadCloser
 }
@@ -56,12 +56,39 @@ func (c *Commit) Trace() {
 	traceHeaders(c.Headers)
 }
 
-func MakeCommit(ifs IFS, prv crypto.PrivateKey, src fs.FS, ts time.Time) (commit *Commit, err error) {
+// CommitOption configures MakeCommit
+type CommitOption func(*commitConfig)
+
+type commitConfig struct {
+	cache   *HashCache
+	exclude func(path string) bool
+	fields  map[string]Header // custom header fields of nodes (see ImportTar)
+	message string
+	device  string
+	time    time.Time // (see WithTime)
+}
+
+// WithTime sets the time of the commit made by CommitBuilder.Build or Revert (the current time by default).
+// A time not later than the current version is replaced by the next second after it.
+func WithTime(ts time.Time) CommitOption {
+	return func(cfg *commitConfig) {
+		cfg.time = ts
+	}
+}
+
+func MakeCommit(ifs IFS, signer crypto.Signer, src fs.FS, ts time.Time, opts ...CommitOption) (commit *Commit, err error) {
 	defer recoverError(&err)
 
-	root := ifs.Root().Copy()   // root info
-	ver := root.Ver() + 1       // new ver
-	partSize := root.PartSize() //
+	var cfg commitConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cache := cfg.cache.begin()
+
+	root := ifs.Root().Copy()            // root info
+	ver := root.Ver() + 1                // new ver
+	partSize := root.PartSize()          //
+	author := commitAuthor(root, signer) // (nil for the owner)
 
 	if ts.IsZero() {
 		ts = time.Now()
@@ -75,22 +102,24 @@ func MakeCommit(ifs IFS, prv crypto.PrivateKey, src fs.FS, ts time.Time) (commit
 		Headers: []Header{root},
 		Body:    files,
 	}
-	commit.Info.SetInt("PrevVer", root.Ver())
-	//commit.Info.SetBytes("PrevHash", root.Hash())
+	commit.Info = cfg.newInfo(root)
+	if fields, ok := cfg.fields[""]; ok { // custom fields of the root-header
+		commit.Headers[0] = setCustomFields(root, fields)
+	}
 
 	mCommit := map[string]bool{"": true}          //
 	mDisk := map[string]bool{"": true, "/": true} // on disk
 
 	var newHH = []Header{root} // new fs headers
-	var diskWalk func(string)
-	diskWalk = func(path string) {
-		if !IsValidPath(path) {
+	var diskWalk func(path string, rules []ignoreRule, dirUp bool)
+	diskWalk = func(path string, rules []ignoreRule, dirUp bool) { // dirUp – the parent directory is updated
+		if !IsValidPath(path) || isIgnored(rules, path) || cfg.exclude != nil && cfg.exclude(path) {
 			return
 		}
 		var dfsPath = path[1:] // trim prefix '/'
 		var isDir = strings.HasSuffix(path, "/")
 		h := valExcludedNotFound(ifs.FileHeader(path))
-		exists := h != nil
+		exists := h != nil && !h.Deleted() // (deleted node is restored by the new version)
 		if !exists {
 			h = NewHeader(path)
 		}
@@ -98,15 +127,31 @@ func MakeCommit(ifs IFS, prv crypto.PrivateKey, src fs.FS, ts time.Time) (commit
 		var fileMerkle []byte
 		var fileSize int64
 		if !isDir {
-			fileSize, fileMerkle, _ = fsMerkleRoot(src, dfsPath, partSize)
+			fileSize, fileMerkle = cache.fileMerkle(src, dfsPath, partSize)
 		}
-		if !exists || !isDir && !bytes.Equal(h.GetBytes(headerMerkleHash), fileMerkle) { // not exists or changed
+		fields, hasFields := cfg.fields[path]
+		changed := !exists || !isDir && !bytes.Equal(h.GetBytes(headerMerkleHash), fileMerkle) ||
+			hasFields && customFields(h).String() != fields.String()
+		if changed { // not exists or changed
 			h.SetInt(headerVer, ver) // set new version
+			h.SetTime(headerUpdated, ts)
+			setAuthor(&h, author)
+			if hasFields {
+				h = setCustomFields(h, fields)
+			}
 			if !isDir {
 				h.SetInt(headerFileSize, fileSize)
 				h.SetBytes(headerMerkleHash, fileMerkle)
 				files.add(func() (io.ReadCloser, error) {
-					return src.Open(dfsPath)
+					return openSourceFile(src, dfsPath, path, fileSize, partSize, fileMerkle)
+				})
+			}
+			commit.Headers = append(commit.Headers, h)
+			mCommit[path], newHH = true, append(newHH, h)
+		} else if dirUp && path != "/" { // the updated directory has to contain all its children
+			if !isDir && fileSize > 0 {
+				files.add(func() (io.ReadCloser, error) {
+					return openSourceFile(src, dfsPath, path, fileSize, partSize, fileMerkle)
 				})
 			}
 			commit.Headers = append(commit.Headers, h)
@@ -125,25 +170,36 @@ func MakeCommit(ifs IFS, prv crypto.PrivateKey, src fs.FS, ts time.Time) (commit
 			sort.Slice(dd, func(i, j int) bool { // sort
 				return pathLess(dd[i].Name(), dd[j].Name())
 			})
+			for _, f := range dd { // read ignore-file
+				if f.Name() == IgnoreFileName && !f.IsDir() {
+					data := mustVal(fs.ReadFile(src, strings.TrimPrefix(dfsPath+"/"+IgnoreFileName, "./")))
+					rules = append(rules[:len(rules):len(rules)], parseIgnoreRules(path, data)...)
+				}
+			}
 			for _, f := range dd {
 				if f.IsDir() {
-					diskWalk(path + f.Name() + "/")
+					diskWalk(path+f.Name()+"/", rules, changed && exists)
 				} else {
-					diskWalk(path + f.Name())
+					diskWalk(path+f.Name(), rules, changed && exists)
 				}
 			}
 		}
 	}
-	diskWalk("/")
+	diskWalk("/", nil, false)
 
 	//-- add old headers to commit
 	var vfsWalk func(Header)
 	vfsWalk = func(h Header) {
 		path := h.Path()
+		if !mDisk[path] && h.Deleted() { // keep deleted node
+			newHH = append(newHH, h)
+			return
+		}
 		if !mDisk[path] { // delete node
 			h = NewHeader(path)
 			h.SetInt(headerVer, ver)
 			h.SetInt(headerDeleted, 1)
+			setAuthor(&h, author)
 			newHH = append(newHH, h)
 			commit.Headers = append(commit.Headers, h)
 			return // skip all child nodes
@@ -173,7 +229,9 @@ func MakeCommit(ifs IFS, prv crypto.PrivateKey, src fs.FS, ts time.Time) (commit
 	newRoot.SetInt(headerVer, ver)
 	newRoot.SetInt(headerVolume, ndRoot.totalVolume())
 	newRoot.SetBytes(headerMerkleHash, ndRoot.childrenMerkleRoot())
-	newRoot.Sign(prv)
+	commit.signRoot(signer)
+
+	cache.flush()
 	return
 }
 
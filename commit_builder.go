@@ -0,0 +1,386 @@
+package indifs
+
+import (
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CommitBuilder edits a filesystem node by node and makes a commit containing only the changed nodes.
+//
+//	b := NewCommitBuilder(ifs)
+//	b.Put("/docs/readme.txt", strings.NewReader("Hello"))
+//	b.Remove("/tmp/")
+//	commit, err := b.Build(prv)
+//	b.Close()
+//
+// The content passed to Put is copied to temporary files which are removed by Close.
+type CommitBuilder struct {
+	ifs     IFS
+	ver     int64                     // new version
+	prev    Header                    // root-header of the current version
+	root    Header                    // new root-header
+	base    map[string]Header         // headers of the current version
+	headers map[string]Header         // headers of the new version
+	touched map[string]bool           // paths of the commit headers
+	content map[string]openReaderFunc // content of the commit files
+	tmpDir  string                    // directory of the content passed to Put (is created lazily)
+}
+
+var (
+	errPathExists    = errors.New("path already exists")
+	errNodeIsDeleted = errors.New("can`t restore deleted node")
+	errReservedField = errors.New("reserved header field")
+)
+
+// reserved header fields can`t be changed by CommitBuilder.SetHeader
+var reservedHeaderFields = map[string]bool{
+	headerProtocol:     true,
+	headerPublicKey:    true,
+	headerSignature:    true,
+	headerVolume:       true,
+	headerVer:          true,
+	headerPath:         true,
+	headerCreated:      true,
+	headerUpdated:      true,
+	headerDeleted:      true,
+	headerMerkleHash:   true,
+	headerFileSize:     true,
+	headerFilePartSize: true,
+	headerInfoHash:     true,
+	headerSigner:       true,
+	headerDelegate:     true,
+	headerSuccessor:    true,
+	headerAuthor:       true,
+}
+
+func NewCommitBuilder(ifs IFS) (_ *CommitBuilder, err error) {
+	defer recoverError(&err)
+	root := ifs.Root().Copy()
+	b := &CommitBuilder{
+		ifs:     ifs,
+		ver:     root.Ver() + 1,
+		prev:    root.Copy(),
+		root:    root,
+		base:    map[string]Header{},
+		headers: map[string]Header{},
+		touched: map[string]bool{},
+		content: map[string]openReaderFunc{},
+	}
+	var walk func(path string)
+	walk = func(path string) {
+		for _, h := range valExcludedNotFound(ifs.ReadDir(path)) {
+			b.base[h.Path()], b.headers[h.Path()] = h, h
+			if h.IsDir() && !h.Deleted() {
+				walk(h.Path())
+			}
+		}
+	}
+	walk("")
+	return b, nil
+}
+
+func (b *CommitBuilder) exists(path string) bool {
+	h := b.headers[path]
+	return path == "" || h != nil && !h.Deleted()
+}
+
+// Put creates or replaces the file; missing parent directories are created.
+// The content is copied to a temporary file (see Close).
+func (b *CommitBuilder) Put(path string, r io.Reader) (err error) {
+	defer recoverError(&err)
+	require(IsValidPath(path) && !isDir(path), errInvalidPath)
+	h := b.newHeader(path)
+	partSize := b.root.PartSize()
+	if h.Has(headerFilePartSize) {
+		partSize = h.PartSize()
+	}
+	if b.tmpDir == "" {
+		b.tmpDir = mustVal(os.MkdirTemp("", "indifs-builder-"))
+	}
+	file := mustVal(os.CreateTemp(b.tmpDir, "put-"))
+	defer file.Close()
+	w := crypto.NewMerkleHash(partSize)
+	size := mustVal(io.Copy(io.MultiWriter(file, w), r))
+	must(file.Close())
+
+	h.SetInt(headerFileSize, size)
+	if size > 0 {
+		h.SetBytes(headerMerkleHash, w.Root())
+	} else {
+		h.Delete(headerMerkleHash)
+	}
+	name := file.Name()
+	b.put(h, func() (io.ReadCloser, error) {
+		return os.Open(name)
+	})
+	return
+}
+
+// Close removes temporary files of the content passed to Put.
+// Commits built before remain readable on systems allowing to remove open files;
+// otherwise they have to be applied before Close.
+func (b *CommitBuilder) Close() error {
+	if b.tmpDir == "" {
+		return nil
+	}
+	dir := b.tmpDir
+	b.tmpDir = ""
+	return os.RemoveAll(dir)
+}
+
+// Mkdir creates the directory and missing parent directories
+func (b *CommitBuilder) Mkdir(path string) (err error) {
+	defer recoverError(&err)
+	if !isDir(path) {
+		path += "/"
+	}
+	require(IsValidPath(path), errInvalidPath)
+	b.mkdirAll(path)
+	return
+}
+
+// Remove deletes the file or the directory with all its content
+func (b *CommitBuilder) Remove(path string) (err error) {
+	defer recoverError(&err)
+	require(IsValidPath(path) && path != "/", errInvalidPath)
+	require(b.exists(path), ErrNotFound)
+	b.remove(path)
+	return
+}
+
+// Rename moves the file or the directory with all its content to the new path
+func (b *CommitBuilder) Rename(oldPath, newPath string) (err error) {
+	defer recoverError(&err)
+	require(IsValidPath(oldPath) && oldPath != "/", errInvalidPath)
+	require(IsValidPath(newPath) && newPath != "/", errInvalidPath)
+	require(isDir(oldPath) == isDir(newPath), errInvalidPath)
+	require(!isDir(oldPath) || !strings.HasPrefix(newPath, oldPath), errInvalidPath)
+	require(b.exists(oldPath), ErrNotFound)
+	require(!b.exists(newPath), errPathExists)
+	b.rename(oldPath, newPath)
+	b.remove(oldPath)
+	return
+}
+
+// SetHeader sets the custom header field of the file or the directory ("" – the root-header).
+// An empty value deletes the field.
+func (b *CommitBuilder) SetHeader(path, key, value string) (err error) {
+	defer recoverError(&err)
+	require(!reservedHeaderFields[key], errReservedField)
+	require(ValidateHeader(Header{{key, []byte(value)}}) == nil, errInvalidHeader)
+	require(b.exists(path), ErrNotFound)
+
+	h := b.root
+	if path != "" {
+		b.touch(path)
+		h = b.headers[path]
+	}
+	if value == "" {
+		h.Delete(key)
+	} else {
+		h.Set(key, value)
+	}
+	if path == "" {
+		b.root = h
+	} else {
+		b.headers[path] = h
+	}
+	return
+}
+
+// Build makes the signed commit of the changes
+// (options WithMessage and WithDevice set the commit info, WithTime sets the time of the commit)
+func (b *CommitBuilder) Build(signer crypto.Signer, opts ...CommitOption) (commit *Commit, err error) {
+	var opened []io.ReadCloser
+	defer func() {
+		if err != nil { // the opened readers are not returned with the commit
+			for _, r := range opened {
+				r.Close()
+			}
+			commit = nil
+		}
+	}()
+	defer recoverError(&err)
+	var cfg commitConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	root := b.root.Copy()
+	ts := cfg.time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	if ts.Unix() <= root.Updated().Unix() {
+		ts = root.Updated().Add(time.Second)
+	}
+	author := commitAuthor(root, signer)
+	for path := range b.touched { // (headers of the new version)
+		if h := b.headers[path]; h.Ver() == b.ver {
+			h = h.Copy()
+			setAuthor(&h, author)
+			if !h.Deleted() {
+				h.SetTime(headerUpdated, ts)
+			}
+			b.headers[path] = h
+		}
+	}
+
+	hh := []Header{root}
+	for _, h := range b.headers {
+		hh = append(hh, h)
+	}
+	sortHeaders(hh)
+	ndRoot := mustVal(indexTree(hh))[""]
+
+	files := newMultiReader()
+	commit = &Commit{
+		Headers: []Header{root},
+		Body:    files,
+	}
+	commit.Info = cfg.newInfo(b.prev)
+	for path := range b.touched {
+		commit.Headers = append(commit.Headers, b.headers[path].Copy())
+	}
+	sortHeaders(commit.Headers)
+
+	// readers are opened in advance, so the content of the same filesystem can be read while the commit is applied
+	for _, h := range commit.Headers {
+		if h.FileSize() > 0 {
+			r := mustVal(b.content[h.Path()]())
+			opened = append(opened, r)
+			files.add(func() (io.ReadCloser, error) { return r, nil })
+		}
+	}
+
+	//--- set merkle + sign
+	newRoot := &commit.Headers[0]
+	if !newRoot.Has(headerCreated) {
+		newRoot.SetTime(headerCreated, ts)
+	}
+	newRoot.SetTime(headerUpdated, ts)
+	newRoot.SetInt(headerVer, b.ver)
+	newRoot.SetInt(headerVolume, ndRoot.totalVolume())
+	newRoot.SetBytes(headerMerkleHash, ndRoot.childrenMerkleRoot())
+	commit.signRoot(signer)
+	return
+}
+
+// newHeader returns header for the new or changed node at the path
+func (b *CommitBuilder) newHeader(path string) Header {
+	h := b.headers[path]
+	require(h == nil || !h.Deleted() || b.touched[path], errNodeIsDeleted)
+	if other := strings.TrimSuffix(path, "/"); path != "/" { // file and dir can`t have the same name
+		if other == path {
+			other += "/"
+		}
+		require(!b.exists(other), errPathExists)
+	}
+	if h == nil || h.Deleted() {
+		h = NewHeader(path)
+	} else {
+		h = h.Copy()
+	}
+	h.SetInt(headerVer, b.ver)
+	return h
+}
+
+func (b *CommitBuilder) put(h Header, content openReaderFunc) {
+	path := h.Path()
+	b.mkdirAll(dirname(path))
+	b.headers[path], b.touched[path] = h, true
+	delete(b.content, path)
+	if h.FileSize() > 0 {
+		b.content[path] = content
+	}
+}
+
+func (b *CommitBuilder) mkdirAll(path string) {
+	if b.exists(path) {
+		return
+	}
+	b.put(b.newHeader(path), nil)
+}
+
+// touch adds the node to the commit with the new version.
+// Direct children of a directory are added too (a directory of the new version replaces all its content).
+func (b *CommitBuilder) touch(path string) {
+	if b.headers[path].Ver() == b.ver {
+		return
+	}
+	h := b.headers[path].Copy()
+	h.SetInt(headerVer, b.ver)
+	b.headers[path], b.touched[path] = h, true
+	b.content[path] = b.contentOf(path)
+	if h.IsDir() {
+		for _, child := range b.children(path) {
+			if !b.touched[child] {
+				b.touched[child] = true
+				b.content[child] = b.contentOf(child)
+			}
+		}
+	}
+}
+
+func (b *CommitBuilder) contentOf(path string) openReaderFunc {
+	if c := b.content[path]; c != nil {
+		return c
+	}
+	return func() (io.ReadCloser, error) {
+		return b.ifs.OpenAt(path, 0)
+	}
+}
+
+// children returns sorted paths of direct children of the directory
+func (b *CommitBuilder) children(dir string) (paths []string) {
+	for path := range b.headers {
+		if path != dir && dirname(path) == dir {
+			paths = append(paths, path)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return pathLess(paths[i], paths[j])
+	})
+	return
+}
+
+func (b *CommitBuilder) rename(oldPath, newPath string) {
+	h := b.newHeader(newPath)
+	for _, f := range b.headers[oldPath] { // copy fields of the old node
+		if f.Name != headerPath && f.Name != headerVer && (f.Name != headerMerkleHash || !h.IsDir()) {
+			h.Set(f.Name, string(f.Value))
+		}
+	}
+	b.put(h, b.contentOf(oldPath))
+	if isDir(oldPath) {
+		for _, child := range b.children(oldPath) {
+			if b.exists(child) {
+				b.rename(child, newPath+child[len(oldPath):])
+			}
+		}
+	}
+}
+
+func (b *CommitBuilder) remove(path string) {
+	for p := range b.headers {
+		if p != path && strings.HasPrefix(p, path) && isDir(path) {
+			delete(b.headers, p)
+			delete(b.touched, p)
+			delete(b.content, p)
+		}
+	}
+	delete(b.content, path)
+	if b.base[path] == nil { // the node is created by the builder
+		delete(b.headers, path)
+		delete(b.touched, path)
+		return
+	}
+	h := NewHeader(path)
+	h.SetInt(headerVer, b.ver)
+	h.SetInt(headerDeleted, 1)
+	b.headers[path], b.touched[path] = h, true
+}
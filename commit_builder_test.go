@@ -0,0 +1,122 @@
+package indifs
+
+import (
+	"errors"
+	"github.com/indifs/indifs/test_data"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommitBuilder(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1")
+
+	b := mustVal(NewCommitBuilder(s))
+	defer b.Close()
+	must(b.Put("/new/dir/x.txt", strings.NewReader("hello")))
+	must(b.Put("/readme.txt", strings.NewReader("changed")))
+	must(b.Remove("/B/1/"))
+	must(b.Rename("/A/", "/D/"))
+	must(b.SetHeader("/index.html", "Content-Type", "text/html"))
+	must(b.SetHeader("", "Title", "Test"))
+	must(b.Mkdir("/new"))
+
+	commit := mustVal(b.Build(testPrv))
+	var paths []string
+	for _, h := range commit.Headers[1:] {
+		paths = append(paths, h.Path())
+	}
+	assert(t, equal(paths, []string{"/A/", "/B/1/", "/D/", "/D/1.txt", "/D/2.txt", "/index.html", "/new/", "/new/dir/", "/new/dir/x.txt", "/readme.txt"}))
+
+	err := s.Commit(commit)
+	assert(t, err == nil)
+	assert(t, s.Root().Ver() == 2)
+	assert(t, s.Root().Get("Title") == "Test")
+	assert(t, mustVal(s.FileHeader("/index.html")).Get("Content-Type") == "text/html")
+	assert(t, testReadFile(s, "/new/dir/x.txt") == "hello")
+	assert(t, testReadFile(s, "/readme.txt") == "changed")
+	assert(t, testReadFile(s, "/D/1.txt") == string(mustVal(fs.ReadFile(test_data.FS("commit1"), "A/1.txt"))))
+	assert(t, mustVal(s.FileHeader("/A/")).Deleted())
+	assert(t, mustVal(s.FileHeader("/B/1/")).Deleted())
+	assert(t, !mustVal(s.FileHeader("/B/1.txt")).Deleted())
+
+	// the commit is replicated as usual
+	s2 := applyCommit(newTestIFS(), "commit1")
+	must(s2.Commit(mustVal(s.GetCommit(1))))
+	assert(t, equal(fsHeaders(s2), fsHeaders(s)))
+
+	//--- errors
+	b = mustVal(NewCommitBuilder(s))
+	assert(t, errors.Is(b.Remove("/A/1.txt"), ErrNotFound))
+	assert(t, errors.Is(b.Put("/A/x.txt", strings.NewReader("x")), errNodeIsDeleted))
+	assert(t, errors.Is(b.Rename("/D/1.txt", "/readme.txt"), errPathExists))
+	assert(t, errors.Is(b.Rename("/D/", "/D/E/"), errInvalidPath))
+	assert(t, errors.Is(b.Mkdir("/readme.txt"), errPathExists))
+	assert(t, errors.Is(b.SetHeader("/readme.txt", "Size", "1"), errReservedField))
+
+	// a directory of the new version includes its children
+	must(b.SetHeader("/D/", "Color", "red"))
+	commit = mustVal(b.Build(testPrv))
+	assert(t, len(commit.Headers) == 4) // root, "/D/", "/D/1.txt", "/D/2.txt"
+	must(s.Commit(commit))
+	assert(t, testReadFile(s, "/D/2.txt") == string(mustVal(fs.ReadFile(test_data.FS("commit1"), "A/2.txt"))))
+}
+
+func TestCommitBuilder_timeAndClose(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1")
+	ts := testCommitTime.Add(time.Hour)
+
+	b := mustVal(NewCommitBuilder(s))
+	must(b.Put("/x.txt", strings.NewReader("hello")))
+	dir := b.tmpDir
+	_, err := os.Stat(dir)
+	assert(t, err == nil)
+
+	commit := mustVal(b.Build(testPrv, WithTime(ts)))
+	must(s.Commit(commit))
+	assert(t, s.Root().Updated().Equal(ts))
+	assert(t, mustVal(s.FileHeader("/x.txt")).Updated().Equal(ts))
+	assert(t, testReadFile(s, "/x.txt") == "hello")
+
+	// temporary files are removed
+	must(b.Close())
+	_, err = os.Stat(dir)
+	assert(t, os.IsNotExist(err))
+}
+
+func testReadFile(s IFS, path string) string {
+	return string(mustVal(io.ReadAll(mustVal(s.OpenAt(path, 0)))))
+}
+
+func TestCommitBuilder_Build_signError(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1")
+	b := mustVal(NewCommitBuilder(s))
+	defer b.Close()
+	must(b.Put("/x.txt", strings.NewReader("hello")))
+	open := b.content["/x.txt"]
+	var r *testClosingReader
+	b.content["/x.txt"] = func() (io.ReadCloser, error) {
+		r = &testClosingReader{ReadCloser: mustVal(open())}
+		return r, nil
+	}
+
+	// the opened content is closed if the commit can`t be signed
+	commit, err := b.Build(testFailingSigner{testPub})
+	assert(t, errors.Is(err, errTestNoDevice))
+	assert(t, commit == nil)
+	assert(t, r != nil && r.closed)
+}
+
+// testClosingReader says the reader is closed
+type testClosingReader struct {
+	io.ReadCloser
+	closed bool
+}
+
+func (r *testClosingReader) Close() error {
+	r.closed = true
+	return r.ReadCloser.Close()
+}
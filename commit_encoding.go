@@ -0,0 +1,190 @@
+package indifs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Binary encoding of Commit:
+//
+//	"IFSC" <version:byte>
+//	<headers-block-size:uvarint> <headers-block>
+//	<body-size:uvarint> <body>
+//
+// headers-block:
+//
+//	<headers-count:uvarint> <Info> <Headers[0]> ... <Headers[n-1]>
+//
+// header:
+//
+//	<fields-count:uvarint> ( <name-len:uvarint> <name> <value-len:uvarint> <value> )...
+//
+// The body size has to be equal to the total size of files of the commit (see Commit.BodySize).
+const (
+	commitMagic          = "IFSC"
+	commitEncodingVer    = 1
+	MaxCommitHeadersSize = 16 << 20 // (16 MiB) – max size of encoded headers of a commit
+	MaxCommitHeaders     = 1 << 17  // max count of headers of a commit
+
+	maxCommitFields = 16 * MaxCommitHeaders // max count of header fields of a commit (bounds memory of decoded headers)
+)
+
+var (
+	errInvalidCommitEncoding    = errors.New("invalid commit encoding")
+	errUnsupportedCommitVersion = errors.New("unsupported commit encoding version")
+)
+
+// WriteTo writes the binary encoding of the commit to w; the commit body is read and closed.
+func (c *Commit) WriteTo(w io.Writer) (n int64, err error) {
+	defer recoverError(&err)
+	if c.Body != nil {
+		defer c.Body.Close()
+	}
+	require(len(c.Headers) <= MaxCommitHeaders, errInvalidCommitEncoding)
+	var hb []byte
+	hb = binary.AppendUvarint(hb, uint64(len(c.Headers)))
+	hb = appendHeader(hb, c.Info)
+	fields := len(c.Info)
+	for _, h := range c.Headers {
+		hb = appendHeader(hb, h)
+		fields += len(h)
+	}
+	require(len(hb) <= MaxCommitHeadersSize && fields <= maxCommitFields, errInvalidCommitEncoding)
+
+	buf := append([]byte(commitMagic), commitEncodingVer)
+	buf = binary.AppendUvarint(buf, uint64(len(hb)))
+	buf = append(buf, hb...)
+	bodySize := c.BodySize()
+	buf = binary.AppendUvarint(buf, uint64(bodySize))
+
+	m, err := w.Write(buf)
+	if n += int64(m); err != nil {
+		return
+	}
+	if bodySize > 0 {
+		require(c.Body != nil, "commit body is not set")
+		m64, err := io.Copy(w, io.LimitReader(c.Body, bodySize))
+		n += m64
+		must(err)
+		require(m64 == bodySize, io.ErrUnexpectedEOF)
+	}
+	return
+}
+
+func appendHeader(buf []byte, h Header) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(h)))
+	for _, f := range h {
+		buf = binary.AppendUvarint(buf, uint64(len(f.Name)))
+		buf = append(buf, f.Name...)
+		buf = binary.AppendUvarint(buf, uint64(len(f.Value)))
+		buf = append(buf, f.Value...)
+	}
+	return buf
+}
+
+// ReadCommit reads the binary encoding of a commit (see Commit.WriteTo).
+// The body of the commit is read from r on demand; the body returns io.ErrUnexpectedEOF if r ends prematurely.
+//
+// If r is not an io.ByteReader, it is buffered and data following the commit can be consumed;
+// use *bufio.Reader to read several commits from one stream.
+func ReadCommit(r io.Reader) (_ *Commit, err error) {
+	defer recoverError(&err)
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	magic := make([]byte, len(commitMagic)+1)
+	_, err = io.ReadFull(br, magic)
+	require(err == nil && string(magic[:len(commitMagic)]) == commitMagic, errInvalidCommitEncoding)
+	require(magic[len(commitMagic)] == commitEncodingVer, errUnsupportedCommitVersion)
+
+	// the headers block is read incrementally, so memory is allocated for the read data only
+	hbSize := readUvarint(br)
+	require(hbSize <= MaxCommitHeadersSize, errInvalidCommitEncoding)
+	hr := &headersReader{r: br, n: int64(hbSize), fields: maxCommitFields}
+	n := readUvarint(hr)
+	require(n > 0 && n <= MaxCommitHeaders, errInvalidCommitEncoding)
+	c := &Commit{Info: hr.readHeader()}
+	for i := uint64(0); i < n; i++ {
+		c.Headers = append(c.Headers, hr.readHeader())
+	}
+	require(hr.n == 0, errInvalidCommitEncoding)
+
+	bodySize := readUvarint(br)
+	require(bodySize == uint64(c.BodySize()), errInvalidCommitEncoding)
+	c.Body = io.NopCloser(&exactReader{r: br, n: int64(bodySize)})
+	return c, nil
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func readUvarint(r io.ByteReader) uint64 {
+	v, err := binary.ReadUvarint(r)
+	require(err == nil, errInvalidCommitEncoding)
+	return v
+}
+
+// headersReader reads the headers block of n bytes from r
+type headersReader struct {
+	r      byteReader
+	n      int64 // remaining size of the block
+	fields int   // remaining count of header fields
+}
+
+func (r *headersReader) ReadByte() (byte, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	r.n--
+	return r.r.ReadByte()
+}
+
+func (r *headersReader) readHeader() (h Header) {
+	n := readUvarint(r)
+	require(n <= uint64(r.n) && n <= uint64(r.fields), errInvalidCommitEncoding)
+	r.fields -= int(n)
+	for i := uint64(0); i < n; i++ {
+		name := r.readBytes(MaxHeaderNameLength)
+		h = append(h, HeaderField{string(name), r.readBytes(MaxHeaderValueLength)})
+	}
+	return
+}
+
+func (r *headersReader) readBytes(maxLen int) []byte {
+	n := readUvarint(r)
+	require(n <= uint64(maxLen) && n <= uint64(r.n), errInvalidCommitEncoding)
+	b := make([]byte, n)
+	_, err := io.ReadFull(r.r, b)
+	require(err == nil, errInvalidCommitEncoding)
+	r.n -= int64(n)
+	return b
+}
+
+// exactReader reads n bytes from r; it returns io.ErrUnexpectedEOF if r ends earlier
+type exactReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *exactReader) Read(p []byte) (n int, err error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err = r.r.Read(p)
+	r.n -= int64(n)
+	if err == io.EOF && r.n > 0 {
+		err = io.ErrUnexpectedEOF
+	} else if err == io.EOF {
+		err = nil
+	}
+	return
+}
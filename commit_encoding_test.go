@@ -0,0 +1,88 @@
+package indifs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestCommit_WriteTo(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1")
+	commit2 := makeTestCommit(s, "commit2")
+	commit3 := makeTestCommit(applyCommit(newTestIFS(), "commit1", "commit2"), "commit3")
+
+	buf := bytes.NewBuffer(nil)
+	n, err := commit2.WriteTo(buf)
+	assert(t, err == nil)
+	assert(t, n == int64(buf.Len()))
+	_, err = commit3.WriteTo(buf)
+	assert(t, err == nil)
+	data := buf.Bytes()
+
+	// read several commits from one stream
+	r := bufio.NewReader(bytes.NewReader(data))
+	c2, err := ReadCommit(r)
+	assert(t, err == nil)
+	assert(t, equal(c2.Info, commit2.Info))
+	assert(t, equal(c2.Headers, commit2.Headers))
+	must(s.Commit(c2))
+
+	c3, err := ReadCommit(r)
+	assert(t, err == nil)
+	must(s.Commit(c3))
+	assert(t, equal(fsHeaders(s), fsHeaders(applyCommit(newTestIFS(), "commit1", "commit2", "commit3"))))
+
+	// truncated body
+	c2, err = ReadCommit(bytes.NewReader(data[:n-1]))
+	assert(t, err == nil)
+	_, err = io.ReadAll(c2.Body)
+	assert(t, err == io.ErrUnexpectedEOF)
+	assert(t, applyCommit(newTestIFS(), "commit1").Commit(c2) != nil)
+
+	// invalid encoding
+	_, err = ReadCommit(bytes.NewReader(data[:20]))
+	assert(t, errors.Is(err, errInvalidCommitEncoding))
+	_, err = ReadCommit(bytes.NewBufferString("commit"))
+	assert(t, errors.Is(err, errInvalidCommitEncoding))
+
+	data = append([]byte{}, data...)
+	data[4] = 2
+	_, err = ReadCommit(bytes.NewReader(data))
+	assert(t, errors.Is(err, errUnsupportedCommitVersion))
+}
+
+func TestReadCommit_limits(t *testing.T) {
+	encode := func(hbSize uint64, hb ...uint64) []byte {
+		buf := append([]byte(commitMagic), commitEncodingVer)
+		buf = binary.AppendUvarint(buf, hbSize)
+		for _, v := range hb {
+			buf = binary.AppendUvarint(buf, v)
+		}
+		return buf
+	}
+
+	// too large headers block
+	_, err := ReadCommit(bytes.NewReader(encode(MaxCommitHeadersSize + 1)))
+	assert(t, errors.Is(err, errInvalidCommitEncoding))
+
+	// declared sizes and counts are greater than the data
+	_, err = ReadCommit(bytes.NewReader(encode(MaxCommitHeadersSize, 1, 0, 1)))
+	assert(t, errors.Is(err, errInvalidCommitEncoding))
+	_, err = ReadCommit(bytes.NewReader(encode(10, MaxCommitHeaders+1)))
+	assert(t, errors.Is(err, errInvalidCommitEncoding))
+	_, err = ReadCommit(bytes.NewReader(encode(10, 1, 1<<40)))
+	assert(t, errors.Is(err, errInvalidCommitEncoding))
+	_, err = ReadCommit(bytes.NewReader(encode(10, 1, 0, 1, 1<<40)))
+	assert(t, errors.Is(err, errInvalidCommitEncoding))
+
+	// too many header fields
+	hb := []uint64{1, 0, maxCommitFields + 1}
+	for i := 0; i <= maxCommitFields; i++ {
+		hb = append(hb, 0, 0)
+	}
+	_, err = ReadCommit(bytes.NewReader(encode(uint64(len(encode(0, hb...))-6), hb...)))
+	assert(t, errors.Is(err, errInvalidCommitEncoding))
+}
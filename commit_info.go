@@ -0,0 +1,175 @@
+package indifs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"strconv"
+	"time"
+)
+
+// Fields of Commit.Info.
+// The info is signed together with the root-header of the commit: the root-header field "Info-Hash" keeps Info.Hash().
+const (
+	infoPrevVer  = "PrevVer"  // version the commit is based on
+	infoPrevHash = "PrevHash" // hash of the root-header of PrevVer
+	infoMessage  = "Message"  // description of the changes
+	infoDevice   = "Device"   // device of the author
+
+	headerInfoHash = "Info-Hash" // (root-header field)
+)
+
+const dbKeyHistoryPrefix = ".h/" // root-header and info of every applied version
+
+// ErrForkedHistory is returned by Commit if the commit is based on a version that differs from the known one.
+var ErrForkedHistory = errors.New("commit is based on another history")
+
+// VersionInfo is the signed root-header of a version with the info of its commit
+type VersionInfo struct {
+	Root    Header `json:"root"`
+	Info    Header `json:"info,omitempty"` // (nil for commits without Info-Hash)
+	Changed int    `json:"changed"`        // count of changed paths (headers of the commit differing from the previous version)
+}
+
+// WithMessage sets Message of the commit info
+func WithMessage(msg string) CommitOption {
+	return func(cfg *commitConfig) {
+		cfg.message = msg
+	}
+}
+
+// WithDevice sets Device of the commit info
+func WithDevice(name string) CommitOption {
+	return func(cfg *commitConfig) {
+		cfg.device = name
+	}
+}
+
+// newInfo returns info of the commit based on the root-header prev
+func (cfg *commitConfig) newInfo(prev Header) (info Header) {
+	info.SetInt(infoPrevVer, prev.Ver())
+	info.SetBytes(infoPrevHash, prev.Hash())
+	if cfg.message != "" {
+		info.Set(infoMessage, cfg.message)
+	}
+	if cfg.device != "" {
+		info.Set(infoDevice, cfg.device)
+	}
+	return
+}
+
+// signRoot sets Info-Hash of the commit root-header and signs it
+// (as a delegate or a successor if the key is not Public-Key of the filesystem)
+func (c *Commit) signRoot(signer crypto.Signer) {
+	root := &c.Headers[0]
+	root.SetBytes(headerInfoHash, c.Info.Hash())
+	if pub := root.PublicKey(); pub != nil && !pub.Equal(signer.PublicKey()) {
+		must(root.SignAsDelegate(signer))
+	} else {
+		must(root.Sign(signer))
+	}
+}
+
+func (v *VersionInfo) Ver() int64         { return v.Root.Ver() }
+func (v *VersionInfo) Updated() time.Time { return v.Root.Updated() }
+func (v *VersionInfo) Volume() int64      { return v.Root.GetInt(headerVolume) }
+func (v *VersionInfo) PrevVer() int64     { return v.Info.GetInt(infoPrevVer) }
+func (v *VersionInfo) PrevHash() []byte   { return v.Info.GetBytes(infoPrevHash) }
+func (v *VersionInfo) Message() string    { return v.Info.Get(infoMessage) }
+func (v *VersionInfo) Device() string     { return v.Info.Get(infoDevice) }
+
+// Verify says the root-header of the filesystem with the public key is signed by the owner (see Header.Verify)
+// and the info is signed with it. Versions committed by delegates are not valid here; use VerifyAuthority.
+func (v *VersionInfo) Verify(pub crypto.PublicKey) bool {
+	return v.Root.Verify() && v.verifyInfo(pub)
+}
+
+// VerifyAuthority says the root-header of the filesystem with the public key is signed by the owner
+// or by a delegate of the previous root-header prev (see Header.VerifyAuthority) and the info is signed with it
+func (v *VersionInfo) VerifyAuthority(pub crypto.PublicKey, prev Header) bool {
+	return v.Root.VerifyAuthority(prev) && v.verifyInfo(pub)
+}
+
+func (v *VersionInfo) verifyInfo(pub crypto.PublicKey) bool {
+	return v.Root.PublicKey().Equal(pub) && v.Root.Has(headerInfoHash) &&
+		bytes.Equal(v.Root.GetBytes(headerInfoHash), v.Info.Hash())
+}
+
+func historyKey(ver int64) string {
+	return dbKeyHistoryPrefix + strconv.FormatInt(ver, 10)
+}
+
+func (f *fileSystem) VersionInfo(ver int64) (v *VersionInfo, err error) {
+	defer recoverError(&err)
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+
+	if v = f.versionInfo(ver); v == nil {
+		return nil, ErrNotFound
+	}
+	return
+}
+
+func (f *fileSystem) Log(fromVer int64, limit int) (log []*VersionInfo, err error) {
+	defer recoverError(&err)
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+
+	if fromVer <= 0 || fromVer > f.Root().Ver() {
+		fromVer = f.Root().Ver()
+	}
+	for _, ver := range f.keyVersions(dbKeyHistoryPrefix, fromVer) {
+		if limit > 0 && len(log) >= limit {
+			break
+		}
+		if v := f.versionInfo(ver); v != nil {
+			log = append(log, v)
+		}
+	}
+	return
+}
+
+func (f *fileSystem) versionInfo(ver int64) (v *VersionInfo) {
+	if ver > 0 && ver <= f.Root().Ver() {
+		f.dbGetJSON(historyKey(ver), &v)
+	}
+	return
+}
+
+// versionRoot returns the known root-header of the version (nil if it is unknown)
+func (f *fileSystem) versionRoot(ver int64) Header {
+	if r := f.Root(); ver == r.Ver() {
+		return r
+	} else if ver == 0 {
+		return NewRootHeader(f.pub)
+	}
+	if v := f.versionInfo(ver); v != nil {
+		return v.Root
+	}
+	return nil
+}
+
+// prevRoot returns the root-header of the version applied before the version ver
+// (the root-header of the empty filesystem if it is unknown)
+func (f *fileSystem) prevRoot(ver int64) Header {
+	for _, v := range f.keyVersions(dbKeyHistoryPrefix, ver-1) {
+		if r := f.versionRoot(v); r != nil {
+			return r
+		}
+	}
+	return f.versionRoot(0)
+}
+
+// verifyCommitInfo verifies the info of the commit with the root-header c; returns the info to be stored
+func (f *fileSystem) verifyCommitInfo(c, info Header) Header {
+	if !c.Has(headerInfoHash) { // the info is not signed
+		return nil
+	}
+	require(ValidateHeader(info) == nil && bytes.Equal(c.GetBytes(headerInfoHash), info.Hash()), "invalid commit Info")
+	prevVer := info.GetInt(infoPrevVer)
+	require(prevVer >= 0 && prevVer < c.Ver() && len(info.GetBytes(infoPrevHash)) > 0, "invalid commit Info")
+	if prev := f.versionRoot(prevVer); prev != nil {
+		require(bytes.Equal(prev.Hash(), info.GetBytes(infoPrevHash)), ErrForkedHistory)
+	}
+	return info
+}
@@ -0,0 +1,116 @@
+package indifs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/indifs/indifs/test_data"
+	"strings"
+	"testing"
+)
+
+func TestFileSystem_VersionInfo(t *testing.T) {
+	s := newTestIFS()
+	commit := mustVal(MakeCommit(s, testPrv, test_data.FS("commit1"), testCommitTime, WithMessage("first"), WithDevice("laptop")))
+	must(s.Commit(commit))
+
+	b := mustVal(NewCommitBuilder(s))
+	must(b.Put("/readme.txt", strings.NewReader("changed")))
+	must(s.Commit(mustVal(b.Build(testPrv, WithMessage("second")))))
+
+	v1 := mustVal(s.VersionInfo(1))
+	v2 := mustVal(s.VersionInfo(2))
+	assert(t, v1.Verify(testPub) && v2.Verify(testPub))
+	assert(t, v1.Message() == "first" && v1.Device() == "laptop" && v1.PrevVer() == 0)
+	assert(t, v2.Message() == "second" && v2.Device() == "" && v2.PrevVer() == 1)
+	assert(t, bytes.Equal(v2.PrevHash(), v1.Root.Hash()))
+	assert(t, equal(v2.Root, s.Root()))
+
+	_, err := s.VersionInfo(3)
+	assert(t, errors.Is(err, ErrNotFound))
+
+	// the info is transmitted with the commit
+	s2 := newTestIFS()
+	must(s2.Commit(mustVal(s.GetCommit(0))))
+	assert(t, mustVal(s2.VersionInfo(2)).Message() == "second")
+	_, err = s2.VersionInfo(1)
+	assert(t, errors.Is(err, ErrNotFound))
+
+	// the info is signed
+	commit = makeTestCommit(s, "commit2")
+	commit.Info.Set(infoMessage, "forged")
+	assert(t, s.Commit(commit) != nil)
+	assert(t, s.Root().Ver() == 2)
+
+	// the commit is based on another version 2
+	s3 := applyCommit(newTestIFS(), "commit1", "commit2", "commit3")
+	err = s.Commit(mustVal(s3.GetCommit(2)))
+	assert(t, errors.Is(err, ErrForkedHistory))
+	assert(t, s.Root().Ver() == 2)
+}
+
+func TestFileSystem_Log(t *testing.T) {
+	s := newTestIFS()
+	assert(t, len(mustVal(s.Log(0, 0))) == 0)
+
+	applyCommit(s, "commit1", "commit2", "commit3")
+
+	log := mustVal(s.Log(0, 0))
+	assert(t, len(log) == 3)
+	for i, v := range log {
+		assert(t, v.Ver() == int64(3-i))
+		assert(t, v.Verify(testPub))
+		assert(t, v.Changed > 0)
+	}
+	assert(t, equal(log[0].Root, s.Root()))
+	assert(t, log[0].Volume() == s.Root().GetInt(headerVolume))
+	assert(t, log[0].Updated().After(log[1].Updated()))
+	assert(t, log[2].Changed == len(makeTestCommit(newTestIFS(), "commit1").Headers)-1)
+
+	log = mustVal(s.Log(2, 1))
+	assert(t, len(log) == 1 && log[0].Ver() == 2)
+	assert(t, bytes.Equal(log[0].Root.Hash(), mustVal(s.Log(0, 0))[1].Root.Hash()))
+
+	// a read-only version lists its history
+	log = mustVal(mustVal(s.OpenVersion(3)).Log(0, 2))
+	assert(t, len(log) == 2 && log[1].Ver() == 2)
+}
+
+func TestVersionInfo_Changed(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1")
+
+	// the directory of the new version is committed with its unchanged children
+	b := mustVal(NewCommitBuilder(s))
+	defer b.Close()
+	must(b.SetHeader("/A/", "Color", "red"))
+	commit := mustVal(b.Build(testPrv))
+	assert(t, len(commit.Headers) == 4)
+	must(s.Commit(commit))
+	assert(t, mustVal(s.VersionInfo(2)).Changed == 1)
+
+	// the replica counts the same
+	r := applyCommit(newTestIFS(), "commit1")
+	must(r.Commit(mustVal(s.GetCommit(1))))
+	assert(t, mustVal(r.VersionInfo(2)).Changed == 1)
+}
+
+func TestVersionInfo_VerifyAuthority(t *testing.T) {
+	bot := testPrv.SubKey("build-bot")
+	s := applyCommit(newTestIFS(), "commit1")
+	b := mustVal(NewCommitBuilder(s))
+	must(b.Delegate(bot.PublicKey(), "/releases/"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+	prev := s.Root()
+
+	b = mustVal(NewCommitBuilder(s))
+	defer b.Close()
+	must(b.Put("/releases/app.bin", strings.NewReader("binary")))
+	must(s.Commit(mustVal(b.Build(bot, WithMessage("release")))))
+
+	v := mustVal(s.VersionInfo(3))
+	assert(t, !v.Verify(testPub)) // (signed by the delegate)
+	assert(t, v.VerifyAuthority(testPub, prev))
+	assert(t, !v.VerifyAuthority(testPub, mustVal(s.VersionInfo(1)).Root)) // the delegation is unknown
+
+	v.Info.Set(infoMessage, "forged")
+	assert(t, !v.VerifyAuthority(testPub, prev))
+}
@@ -0,0 +1,126 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+)
+
+const (
+	pemPKCS8   = "PRIVATE KEY"
+	pemOpenSSH = "OPENSSH PRIVATE KEY"
+
+	openSSHMagic = "openssh-key-v1\x00"
+)
+
+var (
+	errUnsupportedKey = errors.New("unsupported private key")
+	errInvalidOpenSSH = errors.New("invalid OpenSSH private key")
+)
+
+// ImportPrivateKey parses the PEM-encoded private key: PKCS#8 (Ed25519 or ECDSA P-256 key)
+// or unencrypted OpenSSH (Ed25519 key).
+func ImportPrivateKey(data []byte) (PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+	switch block.Type {
+	case pemPKCS8:
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case ed25519.PrivateKey:
+			return PrivateKey(k), nil
+		case *ecdsa.PrivateKey:
+			if k.Curve == elliptic.P256() {
+				return newSchemeKey(ECDSAP256, k.D.FillBytes(make([]byte, 32))), nil
+			}
+		}
+	case pemOpenSSH:
+		return parseOpenSSHPrivateKey(block.Bytes)
+	}
+	return nil, errUnsupportedKey
+}
+
+// ExportPKCS8 returns the PEM-encoded PKCS#8 private key (Ed25519 and ECDSA P-256 keys are supported)
+func ExportPKCS8(prv PrivateKey) ([]byte, error) {
+	var key any
+	switch s, raw := keyScheme(prv, privateKeySize); s {
+	case Ed25519:
+		key = ed25519.PrivateKey(raw)
+	case ECDSAP256:
+		key = s.(ecdsaScheme).privateKey(raw)
+	default:
+		return nil, errUnsupportedKey
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemPKCS8, Bytes: der}), nil
+}
+
+// ExportOpenSSH returns the unencrypted OpenSSH private key with the comment (Ed25519 keys are supported)
+func ExportOpenSSH(prv PrivateKey, comment string) ([]byte, error) {
+	if prv.Scheme() != Ed25519 {
+		return nil, errUnsupportedKey
+	}
+	pubBlob := sshKeyBlob(prv.PublicKey())
+	check := randomBytes(4)
+
+	var priv []byte
+	priv = append(priv, check...)
+	priv = append(priv, check...)
+	priv = appendSSHString(priv, []byte(sshEd25519))
+	priv = appendSSHString(priv, prv.PublicKey())
+	priv = appendSSHString(priv, prv)
+	priv = appendSSHString(priv, []byte(comment))
+	for i := byte(1); len(priv)%8 != 0; i++ { // padding
+		priv = append(priv, i)
+	}
+
+	data := []byte(openSSHMagic)
+	data = appendSSHString(data, []byte("none")) // cipher
+	data = appendSSHString(data, []byte("none")) // kdf
+	data = appendSSHString(data, nil)            // kdf options
+	data = binary.BigEndian.AppendUint32(data, 1)
+	data = appendSSHString(data, pubBlob)
+	data = appendSSHString(data, priv)
+	return pem.EncodeToMemory(&pem.Block{Type: pemOpenSSH, Bytes: data}), nil
+}
+
+func parseOpenSSHPrivateKey(data []byte) (PrivateKey, error) {
+	if len(data) < len(openSSHMagic) || string(data[:len(openSSHMagic)]) != openSSHMagic {
+		return nil, errInvalidOpenSSH
+	}
+	r := &sshReader{data: data[len(openSSHMagic):]}
+	cipherName, kdfName, _ := string(r.string()), string(r.string()), r.string()
+	if r.err == nil && (cipherName != "none" || kdfName != "none") {
+		return nil, errors.New("encrypted OpenSSH private keys are not supported")
+	}
+	if n := r.uint32(); n != 1 {
+		return nil, errInvalidOpenSSH
+	}
+	r.string() // public key
+	r = &sshReader{data: r.string(), err: r.err}
+	check1, check2 := r.uint32(), r.uint32()
+	keyType := string(r.string())
+	pub, prv := r.string(), r.string()
+	if r.err != nil || check1 != check2 {
+		return nil, errInvalidOpenSSH
+	}
+	if keyType != sshEd25519 {
+		return nil, errUnsupportedKey
+	}
+	if len(prv) != privateKeySize || !PrivateKey(prv).PublicKey().Equal(pub) {
+		return nil, errInvalidOpenSSH
+	}
+	return prv, nil
+}
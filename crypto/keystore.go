@@ -0,0 +1,153 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// keystore is the file format of a private key encrypted with a password (see EncryptKey).
+//
+// The key of AES-256-GCM is derived from the password by scrypt with the random salt;
+// the encoded public key is authenticated as additional data.
+type keystore struct {
+	Version    int          `json:"version"`
+	PublicKey  string       `json:"public_key"`
+	KDF        string       `json:"kdf"`
+	KDFParams  scryptParams `json:"kdf_params"`
+	Salt       []byte       `json:"salt"`
+	Cipher     string       `json:"cipher"`
+	Nonce      []byte       `json:"nonce"`
+	Ciphertext []byte       `json:"ciphertext"`
+}
+
+type scryptParams struct {
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+}
+
+const (
+	keystoreVersion = 1
+	keystoreKDF     = "scrypt"
+	keystoreCipher  = "aes-256-gcm"
+	maxScryptN      = 1 << 20 // (128 MiB with r=8)
+	maxScryptR      = 32
+	maxScryptP      = 16
+	maxScryptMemory = 256 << 20 // (256 MiB) – max memory of scrypt: 128*N*r*p
+)
+
+// KeystoreParams are the scrypt cost parameters of new keystores (32 MiB of memory).
+var KeystoreParams = scryptParams{N: 1 << 15, R: 8, P: 1}
+
+var (
+	ErrInvalidPassword = errors.New("keystore: invalid password")
+	errInvalidKeystore = errors.New("keystore: invalid format")
+)
+
+// EncryptKey returns the keystore (JSON) of the private key encrypted with the password
+func EncryptKey(prv PrivateKey, password []byte) ([]byte, error) {
+	pub := prv.PublicKey()
+	if prv.Scheme() == nil || pub.Scheme() == nil {
+		return nil, errors.New("keystore: invalid private key")
+	}
+	ks := &keystore{
+		Version:   keystoreVersion,
+		PublicKey: pub.Encode(),
+		KDF:       keystoreKDF,
+		KDFParams: KeystoreParams,
+		Salt:      randomBytes(32),
+		Cipher:    keystoreCipher,
+	}
+	aead, err := ks.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	ks.Nonce = randomBytes(aead.NonceSize())
+	ks.Ciphertext = aead.Seal(nil, ks.Nonce, prv, []byte(ks.PublicKey))
+	return json.MarshalIndent(ks, "", "  ")
+}
+
+// DecryptKey returns the private key of the keystore (see EncryptKey)
+func DecryptKey(data, password []byte) (PrivateKey, error) {
+	var ks keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, errInvalidKeystore
+	}
+	if ks.Version != keystoreVersion || ks.KDF != keystoreKDF || ks.Cipher != keystoreCipher || !ks.KDFParams.isValid() || len(ks.Salt) == 0 {
+		return nil, errInvalidKeystore
+	}
+	aead, err := ks.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	if len(ks.Nonce) != aead.NonceSize() {
+		return nil, errInvalidKeystore
+	}
+	prv, err := aead.Open(nil, ks.Nonce, ks.Ciphertext, []byte(ks.PublicKey))
+	if err != nil {
+		return nil, ErrInvalidPassword
+	}
+	if pub := DecodePublicKey(ks.PublicKey); pub == nil || PrivateKey(prv).Scheme() == nil || !PrivateKey(prv).PublicKey().Equal(pub) {
+		return nil, errInvalidKeystore
+	}
+	return prv, nil
+}
+
+// WriteKeyFile saves the private key encrypted with the password to the new file (see EncryptKey)
+func WriteKeyFile(path string, prv PrivateKey, password []byte) error {
+	data, err := EncryptKey(prv, password)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadKeyFile returns the private key of the keystore file (the key is a Signer of commits)
+func ReadKeyFile(path string, password []byte) (PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptKey(data, password)
+}
+
+// isValid says the parameters are within the limits of DecryptKey (the keystore is not trusted)
+func (p scryptParams) isValid() bool {
+	return p.N > 1 && p.N <= maxScryptN &&
+		p.R > 0 && p.R <= maxScryptR &&
+		p.P > 0 && p.P <= maxScryptP &&
+		128*int64(p.N)*int64(p.R)*int64(p.P) <= maxScryptMemory
+}
+
+func (ks *keystore) aead(password []byte) (cipher.AEAD, error) {
+	p := ks.KDFParams
+	key, err := scrypt(password, ks.Salt, p.N, p.R, p.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -159,3 +159,33 @@ func VerifyMerkleProof(hash, root, proof []byte) bool {
 	}
 	return bytes.Equal(hash, root)
 }
+
+// VerifyMerkleProofAt verifies the merkle-proof for the hash at the index i of the tree of n leaves.
+// Unlike VerifyMerkleProof, it also checks that the proof corresponds to the position of the leaf.
+func VerifyMerkleProofAt(hash, root, proof []byte, i, n int) bool {
+	if i < 0 || i >= n {
+		return false
+	}
+	ops := merkleProofOps(nil, i, n)
+	if len(proof) != len(ops)*(HashSize+1) {
+		return false
+	}
+	for k, op := range ops {
+		if proof[k*(HashSize+1)] != op {
+			return false
+		}
+	}
+	return VerifyMerkleProof(hash, root, proof)
+}
+
+// merkleProofOps returns operations of the merkle-proof for the index i (see MakeMerkleProof)
+func merkleProofOps(ops []byte, i, n int) []byte {
+	if n <= 1 {
+		return ops
+	}
+	if i2 := merkleMiddle(n); i < i2 {
+		return append(merkleProofOps(ops, i, i2), OpRHash)
+	} else {
+		return append(merkleProofOps(ops, i-i2, n-i2), OpLHash)
+	}
+}
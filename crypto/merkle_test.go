@@ -68,3 +68,18 @@ func newTestHashes(n int) [][]byte {
 	}
 	return hashes
 }
+
+func TestVerifyMerkleProofAt(t *testing.T) {
+
+	for _, n := range []int{1, 2, 3, 7, 100} {
+		hashes := newTestHashes(n)
+		root := MerkleRoot(hashes...)
+
+		for i, hash := range hashes {
+			proof := MakeMerkleProof(hashes, i)
+
+			assert(t, VerifyMerkleProofAt(hash, root, proof, i, n))
+			assert(t, !VerifyMerkleProofAt(hash, root, proof, (i+1)%n, n) || n == 1)
+		}
+	}
+}
@@ -7,29 +7,44 @@ import (
 
 type PrivateKey []byte
 
-const signatureSize = ed25519.SignatureSize
+const privateKeySize = ed25519.PrivateKeySize // (size of Ed25519 keys, see Scheme)
 
+// NewPrivateKeyFromSeed returns the Ed25519 private key made from the seed (see NewPrivateKey).
+// The seed is hashed once, so it is not a password; use GenerateKey and keystore files (see WriteKeyFile) for real keys.
 func NewPrivateKeyFromSeed(seed string) PrivateKey {
-	return PrivateKey(ed25519.NewKeyFromSeed(Hash([]byte(seed))))
+	return NewPrivateKey(Ed25519, seed)
 }
 
 func (prv PrivateKey) String() string {
 	return prv.Encode()
 }
 
+// Scheme returns the signature scheme of the key (nil if the key is invalid)
+func (prv PrivateKey) Scheme() Scheme {
+	s, _ := keyScheme(prv, privateKeySize)
+	return s
+}
+
 func (prv PrivateKey) Encode() string {
-	return "PRIVATE:Ed25519," + base64.StdEncoding.EncodeToString(prv)
+	s, raw := keyScheme(prv, privateKeySize)
+	if s == nil {
+		s, raw = Ed25519, prv
+	}
+	return "PRIVATE:" + s.Name() + "," + base64.StdEncoding.EncodeToString(raw)
 }
 
+// SubKey returns the private key of the same scheme derived from the key and the name
 func (prv PrivateKey) SubKey(name string) PrivateKey {
-	seed := Hash(prv, Hash([]byte(name)))
-	return PrivateKey(ed25519.NewKeyFromSeed(seed))
+	s, _ := keyScheme(prv, privateKeySize)
+	return newSchemeKey(s, s.NewPrivateKey(Hash(prv, Hash([]byte(name)))))
 }
 
 func (prv PrivateKey) PublicKey() PublicKey {
-	return PublicKey(ed25519.PrivateKey(prv).Public().(ed25519.PublicKey))
+	s, raw := keyScheme(prv, privateKeySize)
+	return newSchemeKey(s, s.PublicKey(raw))
 }
 
 func (prv PrivateKey) Sign(message []byte) []byte {
-	return ed25519.Sign([]byte(prv), message)
+	s, raw := keyScheme(prv, privateKeySize)
+	return s.Sign(raw, message)
 }
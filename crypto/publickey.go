@@ -11,17 +11,31 @@ import (
 
 type PublicKey []byte
 
-const publicKeySize = ed25519.PublicKeySize
-
-// TODO: add other encryption types
-const publicKeyEncodingPrefix = "Ed25519,"
+const publicKeySize = ed25519.PublicKeySize // (size of Ed25519 keys, see Scheme)
 
 func (pub PublicKey) String() string {
 	return pub.Encode()
 }
 
+// Scheme returns the signature scheme of the key (nil if the key is invalid)
+func (pub PublicKey) Scheme() Scheme {
+	s, _ := pub.scheme()
+	return s
+}
+
+func (pub PublicKey) scheme() (Scheme, []byte) {
+	if s, raw := keyScheme(pub, publicKeySize); s != nil && s.IsValidPublicKey(raw) {
+		return s, raw
+	}
+	return nil, nil
+}
+
 func (pub PublicKey) Encode() string {
-	return publicKeyEncodingPrefix + base64.StdEncoding.EncodeToString(pub)
+	s, raw := pub.scheme()
+	if s == nil {
+		s, raw = Ed25519, pub
+	}
+	return s.Name() + "," + base64.StdEncoding.EncodeToString(raw)
 }
 
 func (pub PublicKey) ID64() uint64 {
@@ -33,19 +47,24 @@ func (pub PublicKey) ID128() string {
 }
 
 func (pub PublicKey) Equal(p PublicKey) bool {
-	return len(pub) == publicKeySize && bytes.Equal(pub, p)
+	return pub.Scheme() != nil && bytes.Equal(pub, p)
 }
 
 func (pub PublicKey) Verify(message, signature []byte) bool {
-	return len(pub) == publicKeySize &&
-		len(signature) == signatureSize &&
-		ed25519.Verify([]byte(pub), message, signature)
+	s, raw := pub.scheme()
+	return s != nil && s.Verify(raw, message, signature)
 }
 
-func DecodePublicKey(s string) PublicKey {
-	s = strings.TrimPrefix(s, publicKeyEncodingPrefix)
-	if p, _ := base64.StdEncoding.DecodeString(s); len(p) == publicKeySize {
-		return p
+// DecodePublicKey decodes the public key "<scheme-name>,<base64-key>" (Ed25519 if the scheme is omitted)
+func DecodePublicKey(str string) PublicKey {
+	s := Ed25519
+	if name, key, ok := strings.Cut(str, ","); ok {
+		if s, str = SchemeByName(name), key; s == nil {
+			return nil
+		}
+	}
+	if raw, _ := base64.StdEncoding.DecodeString(str); len(raw) > 0 && s.IsValidPublicKey(raw) {
+		return newSchemeKey(s, raw)
 	}
 	return nil
 }
@@ -0,0 +1,189 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"math/big"
+)
+
+// Scheme is a signature algorithm of keys.
+//
+// Keys of the default scheme Ed25519 are raw keys (32 bytes public, 64 bytes private);
+// keys of other schemes are raw keys prefixed with the id of the scheme (see RegisterScheme),
+// so they must not be 32 and 64 bytes long with the prefix.
+// Encoded keys are prefixed with the name of the scheme: "<name>,<base64-raw-key>".
+type Scheme interface {
+	Name() string
+	NewPrivateKey(seed []byte) (prv []byte) // (seed is 32 bytes)
+	PublicKey(prv []byte) (pub []byte)
+	IsValidPublicKey(pub []byte) bool
+	Sign(prv, message []byte) (signature []byte)
+	Verify(pub, message, signature []byte) bool
+}
+
+var (
+	Ed25519   Scheme = ed25519Scheme{}
+	Ed25519ph Scheme = ed25519phScheme{}
+	ECDSAP256 Scheme = ecdsaScheme{elliptic.P256(), "ECDSA-P256"}
+)
+
+var (
+	schemes       = map[byte]Scheme{}
+	schemeIDs     = map[Scheme]byte{}
+	schemesByName = map[string]Scheme{}
+)
+
+func init() {
+	RegisterScheme(0, Ed25519)
+	RegisterScheme(1, Ed25519ph)
+	RegisterScheme(2, ECDSAP256)
+}
+
+// RegisterScheme registers the signature scheme with the id (the prefix of its keys). Id 0 is Ed25519.
+func RegisterScheme(id byte, s Scheme) {
+	if schemes[id] != nil || schemesByName[s.Name()] != nil {
+		panic("crypto: scheme is already registered")
+	}
+	schemes[id], schemeIDs[s], schemesByName[s.Name()] = s, id, s
+}
+
+// SchemeByName returns the registered scheme (nil if not found)
+func SchemeByName(name string) Scheme {
+	return schemesByName[name]
+}
+
+// NewPrivateKey returns the private key of the scheme made from the seed
+func NewPrivateKey(s Scheme, seed string) PrivateKey {
+	return newSchemeKey(s, s.NewPrivateKey(Hash([]byte(seed))))
+}
+
+// GenerateKey returns a random private key of the scheme
+func GenerateKey(s Scheme) PrivateKey {
+	return newSchemeKey(s, s.NewPrivateKey(randomBytes(32)))
+}
+
+func newSchemeKey(s Scheme, raw []byte) []byte {
+	if s == Ed25519 {
+		return raw
+	}
+	return append([]byte{schemeIDs[s]}, raw...)
+}
+
+// keyScheme returns the scheme and the raw key (Ed25519 keys have the size n)
+func keyScheme(key []byte, n int) (Scheme, []byte) {
+	if len(key) == n {
+		return Ed25519, key
+	}
+	if len(key) > 1 {
+		if s := schemes[key[0]]; s != nil && s != Ed25519 {
+			return s, key[1:]
+		}
+	}
+	return nil, nil
+}
+
+//------ Ed25519 ------
+
+type ed25519Scheme struct{}
+
+func (ed25519Scheme) Name() string { return "Ed25519" }
+
+func (ed25519Scheme) NewPrivateKey(seed []byte) []byte {
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+func (ed25519Scheme) PublicKey(prv []byte) []byte {
+	return ed25519.PrivateKey(prv).Public().(ed25519.PublicKey)
+}
+
+func (ed25519Scheme) IsValidPublicKey(pub []byte) bool {
+	return len(pub) == ed25519.PublicKeySize
+}
+
+func (ed25519Scheme) Sign(prv, message []byte) []byte {
+	return ed25519.Sign(prv, message)
+}
+
+func (ed25519Scheme) Verify(pub, message, signature []byte) bool {
+	return len(pub) == ed25519.PublicKeySize &&
+		len(signature) == ed25519.SignatureSize &&
+		ed25519.Verify(pub, message, signature)
+}
+
+//------ Ed25519ph (pre-hashed with SHA-512, RFC 8032) ------
+
+type ed25519phScheme struct{ ed25519Scheme }
+
+var ed25519phOptions = &ed25519.Options{Hash: crypto.SHA512}
+
+func (ed25519phScheme) Name() string { return "Ed25519ph" }
+
+func (ed25519phScheme) Sign(prv, message []byte) []byte {
+	digest := sha512.Sum512(message)
+	sig, err := ed25519.PrivateKey(prv).Sign(nil, digest[:], ed25519phOptions)
+	if err != nil {
+		panic(err)
+	}
+	return sig
+}
+
+func (ed25519phScheme) Verify(pub, message, signature []byte) bool {
+	digest := sha512.Sum512(message)
+	return len(pub) == ed25519.PublicKeySize &&
+		ed25519.VerifyWithOptions(pub, digest[:], signature, ed25519phOptions) == nil
+}
+
+//------ ECDSA (SHA-256, ASN.1 signatures, compressed public keys) ------
+
+type ecdsaScheme struct {
+	curve elliptic.Curve
+	name  string
+}
+
+func (s ecdsaScheme) Name() string { return s.name }
+
+func (s ecdsaScheme) NewPrivateKey(seed []byte) []byte {
+	n := new(big.Int).Sub(s.curve.Params().N, big.NewInt(1))
+	d := new(big.Int).Mod(new(big.Int).SetBytes(Hash(seed)), n)
+	return d.Add(d, big.NewInt(1)).FillBytes(make([]byte, (s.curve.Params().BitSize+7)/8))
+}
+
+func (s ecdsaScheme) privateKey(prv []byte) *ecdsa.PrivateKey {
+	k := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(prv)}
+	k.Curve = s.curve
+	k.X, k.Y = s.curve.ScalarBaseMult(prv)
+	return k
+}
+
+func (s ecdsaScheme) PublicKey(prv []byte) []byte {
+	k := s.privateKey(prv)
+	return elliptic.MarshalCompressed(s.curve, k.X, k.Y)
+}
+
+func (s ecdsaScheme) IsValidPublicKey(pub []byte) bool {
+	x, _ := elliptic.UnmarshalCompressed(s.curve, pub)
+	return x != nil
+}
+
+func (s ecdsaScheme) Sign(prv, message []byte) []byte {
+	digest := sha256.Sum256(message)
+	sig, err := ecdsa.SignASN1(rand.Reader, s.privateKey(prv), digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return sig
+}
+
+func (s ecdsaScheme) Verify(pub, message, signature []byte) bool {
+	x, y := elliptic.UnmarshalCompressed(s.curve, pub)
+	if x == nil {
+		return false
+	}
+	digest := sha256.Sum256(message)
+	return ecdsa.VerifyASN1(&ecdsa.PublicKey{Curve: s.curve, X: x, Y: y}, digest[:], signature)
+}
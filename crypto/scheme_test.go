@@ -0,0 +1,40 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSchemes(t *testing.T) {
+	msg := []byte("test-message")
+	for _, s := range []Scheme{Ed25519, Ed25519ph, ECDSAP256} {
+		prv := NewPrivateKey(s, "seed")
+		pub := prv.PublicKey()
+		assert(t, prv.Scheme() == s && pub.Scheme() == s)
+		assert(t, bytes.Equal(NewPrivateKey(s, "seed"), prv)) // deterministic
+
+		sig := prv.Sign(msg)
+		assert(t, pub.Verify(msg, sig))
+		assert(t, !pub.Verify([]byte("test-messagE"), sig))
+		assert(t, !NewPrivateKey(s, "seed-2").PublicKey().Verify(msg, sig))
+
+		// encoding
+		assert(t, pub.Encode()[:len(s.Name())+1] == s.Name()+",")
+		assert(t, DecodePublicKey(pub.Encode()).Equal(pub))
+
+		sub := prv.SubKey("sub")
+		assert(t, sub.Scheme() == s && !sub.PublicKey().Equal(pub))
+		assert(t, sub.PublicKey().Verify(msg, sub.Sign(msg)))
+		assert(t, GenerateKey(s).Scheme() == s)
+	}
+
+	// keys of different schemes are different
+	assert(t, !NewPrivateKey(Ed25519ph, "seed").PublicKey().Equal(NewPrivateKey(Ed25519, "seed").PublicKey()))
+	sig := NewPrivateKey(Ed25519, "seed").Sign(msg)
+	assert(t, !NewPrivateKey(Ed25519ph, "seed").PublicKey().Verify(msg, sig))
+
+	//--- fail
+	assert(t, DecodePublicKey("Unknown,8WXh5ffCkOUvLt7z+6tgy650v9MnT45e4d4zRclUoWY=") == nil)
+	assert(t, DecodePublicKey("ECDSA-P256,8WXh5ffCkOUvLt7z+6tgy650v9MnT45e4d4zRclUoWY=") == nil)
+	assert(t, PublicKey{9, 1, 2, 3}.Scheme() == nil)
+}
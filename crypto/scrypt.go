@@ -0,0 +1,113 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+var errInvalidScryptParams = errors.New("scrypt: invalid parameters")
+
+// scrypt returns the key derived from the password by the memory-hard function scrypt (RFC 7914)
+// with the cost parameters N (a power of 2), r and p; the function uses 128*N*r bytes of memory.
+func scrypt(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	const maxInt = int(^uint(0) >> 1)
+	if N <= 1 || N&(N-1) != 0 || r <= 0 || p <= 0 ||
+		uint64(r)*uint64(p) >= 1<<30 || r > maxInt/128/p || r > maxInt/256 || N > maxInt/128/r {
+		return nil, errInvalidScryptParams
+	}
+	b := pbkdf2SHA256(password, salt, p*128*r)
+	xy := make([]uint32, 64*r)
+	v := make([]uint32, 32*N*r)
+	for i := 0; i < p; i++ {
+		smix(b[i*128*r:], r, N, v, xy)
+	}
+	return pbkdf2SHA256(password, b, keyLen), nil
+}
+
+// pbkdf2SHA256 returns the key derived by PBKDF2-HMAC-SHA256 with one iteration (as scrypt uses it)
+func pbkdf2SHA256(password, salt []byte, keyLen int) (dk []byte) {
+	prf := hmac.New(sha256.New, password)
+	for block := uint32(1); len(dk) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		dk = prf.Sum(dk)
+	}
+	return dk[:keyLen]
+}
+
+func smix(b []byte, r, N int, v, xy []uint32) {
+	var tmp [16]uint32
+	R := 32 * r
+	x, y := xy[:R], xy[R:]
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	for i := 0; i < N; i += 2 {
+		copy(v[i*R:], x)
+		blockMix(&tmp, x, y, r)
+		copy(v[(i+1)*R:], y)
+		blockMix(&tmp, y, x, r)
+	}
+	for i := 0; i < N; i += 2 {
+		blockXOR(x, v[integer(x, r, N)*R:])
+		blockMix(&tmp, x, y, r)
+		blockXOR(y, v[integer(y, r, N)*R:])
+		blockMix(&tmp, y, x, r)
+	}
+	for i, w := range x {
+		binary.LittleEndian.PutUint32(b[4*i:], w)
+	}
+}
+
+// blockMix computes BlockMix of scrypt (the even blocks of the output first, then the odd ones)
+func blockMix(tmp *[16]uint32, in, out []uint32, r int) {
+	copy(tmp[:], in[(2*r-1)*16:])
+	for i := 0; i < 2*r; i += 2 {
+		salsaXOR(tmp, in[i*16:], out[i*8:])
+		salsaXOR(tmp, in[i*16+16:], out[i*8+r*16:])
+	}
+}
+
+func blockXOR(dst, src []uint32) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+func integer(b []uint32, r, N int) int {
+	j := (2*r - 1) * 16
+	return int((uint64(b[j]) | uint64(b[j+1])<<32) & uint64(N-1))
+}
+
+// salsaXOR sets tmp and out to Salsa20/8(tmp XOR in)
+func salsaXOR(tmp *[16]uint32, in, out []uint32) {
+	for i := range tmp {
+		tmp[i] ^= in[i]
+	}
+	x := *tmp
+	for i := 0; i < 8; i += 2 {
+		salsaQuarterRound(&x, 0, 4, 8, 12) // columns
+		salsaQuarterRound(&x, 5, 9, 13, 1)
+		salsaQuarterRound(&x, 10, 14, 2, 6)
+		salsaQuarterRound(&x, 15, 3, 7, 11)
+		salsaQuarterRound(&x, 0, 1, 2, 3) // rows
+		salsaQuarterRound(&x, 5, 6, 7, 4)
+		salsaQuarterRound(&x, 10, 11, 8, 9)
+		salsaQuarterRound(&x, 15, 12, 13, 14)
+	}
+	for i := range tmp {
+		tmp[i] += x[i]
+	}
+	copy(out, tmp[:])
+}
+
+func salsaQuarterRound(x *[16]uint32, a, b, c, d int) {
+	x[b] ^= bits.RotateLeft32(x[a]+x[d], 7)
+	x[c] ^= bits.RotateLeft32(x[b]+x[a], 9)
+	x[d] ^= bits.RotateLeft32(x[c]+x[b], 13)
+	x[a] ^= bits.RotateLeft32(x[d]+x[c], 18)
+}
@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestScrypt(t *testing.T) {
+	for _, c := range []struct {
+		password, salt string
+		N, r, p        int
+		key            string
+	}{
+		//--- RFC 7914 test vectors (section 12)
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+		{"pleaseletmein", "SodiumChloride", 16384, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+		{"pleaseletmein", "SodiumChloride", 1 << 20, 8, 1, "2101cb9b6a511aaeaddbbe09cf70f881ec568d574a2ffd4dabe5ee9820adaa478e56fd8f4ba5d09ffa1c6d927c40f4c337304049e8a952fbcbf45c6fa77a41a4"},
+
+		//--- odd r, p and key lengths (keys by OpenSSL)
+		{"password", "salt", 2, 1, 1, "6d1bb878eee9ce4a7b77d7a44103574d4cbfe3c15ae3940f0ffe75cd5e1e0afa"},
+		{"password", "salt", 32, 3, 2, "f226ca4336865a71f35a052a46ccbcf8d5cc51e4257f311b70af890d35e5f288c08e2c52482da543"},
+		{"secret", "", 256, 5, 3, "e646955b71b325ea4187df0a8628608c"},
+	} {
+		if size := 128 * c.N * c.r; size > 256<<20 && testing.Short() {
+			t.Logf("skipped in short mode: N=%d r=%d (%d MiB)", c.N, c.r, size>>20)
+			continue
+		}
+		key, err := scrypt([]byte(c.password), []byte(c.salt), c.N, c.r, c.p, len(c.key)/2)
+
+		assert(t, err == nil)
+		assert(t, hex.EncodeToString(key) == c.key)
+	}
+
+	//--- fail
+	_, err := scrypt([]byte("password"), nil, 1000, 8, 1, 32)
+	assert(t, err == errInvalidScryptParams)
+}
+
+func Test_pbkdf2SHA256(t *testing.T) {
+	// RFC 7914 test vector (section 11; one iteration)
+	key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 64)
+	assert(t, hex.EncodeToString(key) == "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783")
+}
@@ -0,0 +1,63 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Signer signs digests (hashes of headers and records) with a private key that may be kept outside the process.
+//
+// Implementations: PrivateKey (in-memory key), NewAgentSigner (OpenSSH agent), NewCommandSigner (subprocess).
+type Signer interface {
+	PublicKey() PublicKey
+	SignDigest(digest []byte) (signature []byte, err error)
+}
+
+var ErrInvalidSignature = errors.New("signer returned invalid signature")
+
+// SignDigest implements Signer
+func (prv PrivateKey) SignDigest(digest []byte) ([]byte, error) {
+	if prv.Scheme() == nil {
+		return nil, errors.New("invalid private key")
+	}
+	return prv.Sign(digest), nil
+}
+
+//------ subprocess signer ------
+
+type commandSigner struct {
+	pub  PublicKey
+	name string
+	args []string
+}
+
+// NewCommandSigner returns the signer running the command for every signature (e.g. a bridge to an HSM).
+//
+// The command gets the base64-encoded digest on stdin and the encoded public key in the environment variable
+// IFS_PUBLIC_KEY; it writes the base64-encoded signature to stdout. The signature is verified with pub.
+func NewCommandSigner(pub PublicKey, name string, args ...string) Signer {
+	return &commandSigner{pub, name, args}
+}
+
+func (s *commandSigner) PublicKey() PublicKey {
+	return s.pub
+}
+
+func (s *commandSigner) SignDigest(digest []byte) ([]byte, error) {
+	cmd := exec.Command(s.name, s.args...)
+	cmd.Env = append(os.Environ(), "IFS_PUBLIC_KEY="+s.pub.Encode())
+	cmd.Stdin = bytes.NewBufferString(base64.StdEncoding.EncodeToString(digest) + "\n")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(out)))
+	if err != nil || !s.pub.Verify(digest, sig) {
+		return nil, ErrInvalidSignature
+	}
+	return sig, nil
+}
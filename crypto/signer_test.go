@@ -0,0 +1,142 @@
+package crypto
+
+import (
+	"bufio"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrivateKey_SignDigest(t *testing.T) {
+	var s Signer = NewPrivateKeyFromSeed("seed")
+	digest := Hash([]byte("test-message"))
+
+	sig, err := s.SignDigest(digest)
+
+	assert(t, err == nil)
+	assert(t, s.PublicKey().Verify(digest, sig))
+}
+
+func TestNewAgentSigner(t *testing.T) {
+	keys := []PrivateKey{NewPrivateKey(Ed25519, "seed"), NewPrivateKey(ECDSAP256, "seed")}
+	socket := startTestAgent(t, keys)
+	digest := Hash([]byte("test-message"))
+
+	pubs, err := AgentKeys(socket)
+	assert(t, err == nil && len(pubs) == 2)
+
+	for _, prv := range keys {
+		s, err := NewAgentSigner(socket, prv.PublicKey())
+		assert(t, err == nil)
+		sig, err := s.SignDigest(digest)
+		assert(t, err == nil)
+		assert(t, prv.PublicKey().Verify(digest, sig))
+	}
+
+	//--- fail
+	_, err = NewAgentSigner(socket, NewPrivateKey(Ed25519ph, "seed").PublicKey())
+	assert(t, errors.Is(err, ErrAgentKeyNotFound))
+	_, err = NewAgentSigner(filepath.Join(t.TempDir(), "none"), keys[0].PublicKey())
+	assert(t, err != nil)
+}
+
+func TestSSHReader_string(t *testing.T) {
+	r := &sshReader{data: appendSSHString(nil, []byte("abc"))}
+	assert(t, string(r.string()) == "abc" && r.err == nil)
+
+	// the length is greater than the data (or int on 32-bit platforms)
+	r = &sshReader{data: []byte{0xff, 0xff, 0xff, 0xff, 'a'}}
+	assert(t, r.string() == nil && r.err == errAgentResponse)
+}
+
+func TestNewCommandSigner(t *testing.T) {
+	t.Setenv("IFS_TEST_SIGNER_SEED", "seed")
+	digest := Hash([]byte("test-message"))
+	pub := NewPrivateKeyFromSeed("seed").PublicKey()
+
+	s := NewCommandSigner(pub, os.Args[0], "-test.run=^TestCommandSignerProcess$")
+	sig, err := s.SignDigest(digest)
+	assert(t, err == nil)
+	assert(t, pub.Verify(digest, sig))
+
+	//--- fail
+	s = NewCommandSigner(NewPrivateKeyFromSeed("seed-2").PublicKey(), os.Args[0], "-test.run=^TestCommandSignerProcess$")
+	_, err = s.SignDigest(digest)
+	assert(t, errors.Is(err, ErrInvalidSignature))
+}
+
+// TestCommandSignerProcess is the subprocess of TestNewCommandSigner
+func TestCommandSignerProcess(t *testing.T) {
+	seed := os.Getenv("IFS_TEST_SIGNER_SEED")
+	if seed == "" || os.Getenv("IFS_PUBLIC_KEY") == "" {
+		return
+	}
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	digest, _ := base64.StdEncoding.DecodeString(line[:len(line)-1])
+	fmt.Println(base64.StdEncoding.EncodeToString(NewPrivateKeyFromSeed(seed).Sign(digest)))
+	os.Exit(0)
+}
+
+// startTestAgent serves the OpenSSH agent protocol with the keys on a unix socket
+func startTestAgent(t *testing.T, keys []PrivateKey) (socket string) {
+	dir, err := os.MkdirTemp("", "agent") // (a short path for the socket)
+	assert(t, err == nil)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket = filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", socket)
+	assert(t, err == nil)
+	t.Cleanup(func() { l.Close() })
+
+	handle := func(req []byte) []byte {
+		r := &sshReader{data: req}
+		switch r.byte() {
+		case agentRequestIdentities:
+			resp := binary.BigEndian.AppendUint32([]byte{agentIdentitiesAnswer}, uint32(len(keys)))
+			for _, prv := range keys {
+				resp = appendSSHString(resp, sshKeyBlob(prv.PublicKey()))
+				resp = appendSSHString(resp, []byte("test"))
+			}
+			return resp
+		case agentSignRequest:
+			blob, data := r.string(), r.string()
+			for _, prv := range keys {
+				if pub := prv.PublicKey(); string(sshKeyBlob(pub)) == string(blob) {
+					sig := prv.Sign(data)
+					format := sshEd25519
+					if pub.Scheme() == ECDSAP256 {
+						var rs struct{ R, S *big.Int }
+						asn1.Unmarshal(sig, &rs)
+						format, sig = sshECDSAP256, appendSSHString(appendSSHString(nil, rs.R.Bytes()), rs.S.Bytes())
+					}
+					return appendSSHString([]byte{agentSignResponse}, appendSSHString(appendSSHString(nil, []byte(format)), sig))
+				}
+			}
+		}
+		return []byte{agentFailure}
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var size [4]byte
+			if _, err = io.ReadFull(conn, size[:]); err == nil {
+				req := make([]byte, binary.BigEndian.Uint32(size[:]))
+				if _, err = io.ReadFull(conn, req); err == nil {
+					conn.Write(appendSSHString(nil, handle(req)))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return
+}
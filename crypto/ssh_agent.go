@@ -0,0 +1,220 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+)
+
+// OpenSSH agent protocol (draft-miller-ssh-agent)
+const (
+	agentFailure           = 5
+	agentRequestIdentities = 11
+	agentIdentitiesAnswer  = 12
+	agentSignRequest       = 13
+	agentSignResponse      = 14
+
+	sshEd25519   = "ssh-ed25519"
+	sshECDSAP256 = "ecdsa-sha2-nistp256"
+
+	maxAgentMessageSize = 256 * 1024
+)
+
+var (
+	ErrAgentKeyNotFound = errors.New("ssh-agent: key not found")
+	errAgentFailure     = errors.New("ssh-agent: failure")
+	errAgentResponse    = errors.New("ssh-agent: invalid response")
+)
+
+type agentSigner struct {
+	socket string
+	pub    PublicKey
+	blob   []byte // ssh wire encoding of the key
+}
+
+// NewAgentSigner returns the signer of the key held by the OpenSSH agent listening on the unix socket
+// (SSH_AUTH_SOCK if socket is empty). Ed25519 and ECDSA-P256 keys are supported.
+func NewAgentSigner(socket string, pub PublicKey) (Signer, error) {
+	if socket == "" {
+		socket = os.Getenv("SSH_AUTH_SOCK")
+	}
+	keys, err := AgentKeys(socket)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Equal(pub) {
+			return &agentSigner{socket, pub, sshKeyBlob(pub)}, nil
+		}
+	}
+	return nil, ErrAgentKeyNotFound
+}
+
+// AgentKeys returns the supported keys held by the OpenSSH agent listening on the unix socket
+func AgentKeys(socket string) (keys []PublicKey, err error) {
+	resp, err := agentCall(socket, []byte{agentRequestIdentities})
+	if err != nil {
+		return
+	}
+	r := &sshReader{data: resp}
+	if r.byte() != agentIdentitiesAnswer {
+		return nil, errAgentResponse
+	}
+	for n := r.uint32(); n > 0 && r.err == nil; n-- {
+		blob, _ := r.string(), r.string() // (key, comment)
+		if pub := parseSSHKeyBlob(blob); pub != nil {
+			keys = append(keys, pub)
+		}
+	}
+	return keys, r.err
+}
+
+func (s *agentSigner) PublicKey() PublicKey {
+	return s.pub
+}
+
+func (s *agentSigner) SignDigest(digest []byte) ([]byte, error) {
+	req := []byte{agentSignRequest}
+	req = appendSSHString(req, s.blob)
+	req = appendSSHString(req, digest)
+	req = binary.BigEndian.AppendUint32(req, 0) // flags
+	resp, err := agentCall(s.socket, req)
+	if err != nil {
+		return nil, err
+	}
+	r := &sshReader{data: resp}
+	if r.byte() != agentSignResponse {
+		return nil, errAgentResponse
+	}
+	r = &sshReader{data: r.string()}
+	format, sig := string(r.string()), r.string()
+	if r.err != nil {
+		return nil, errAgentResponse
+	}
+	if format == sshECDSAP256 { // mpint r, mpint s  ->  ASN.1
+		r = &sshReader{data: sig}
+		rs := struct{ R, S *big.Int }{new(big.Int).SetBytes(r.string()), new(big.Int).SetBytes(r.string())}
+		if sig, err = asn1.Marshal(rs); err != nil || r.err != nil {
+			return nil, errAgentResponse
+		}
+	}
+	if !s.pub.Verify(digest, sig) {
+		return nil, ErrInvalidSignature
+	}
+	return sig, nil
+}
+
+func agentCall(socket string, req []byte) ([]byte, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err = conn.Write(appendSSHString(nil, req)); err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	if _, err = io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n == 0 || n > maxAgentMessageSize {
+		return nil, errAgentResponse
+	}
+	resp := make([]byte, n)
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	if resp[0] == agentFailure {
+		return nil, errAgentFailure
+	}
+	return resp, nil
+}
+
+// sshKeyBlob returns the ssh wire encoding of the public key (nil if the scheme is not supported)
+func sshKeyBlob(pub PublicKey) (blob []byte) {
+	switch s, raw := pub.scheme(); s {
+	case Ed25519:
+		blob = appendSSHString(blob, []byte(sshEd25519))
+		return appendSSHString(blob, raw)
+	case ECDSAP256:
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), raw)
+		point := append([]byte{4}, x.FillBytes(make([]byte, 32))...)
+		point = append(point, y.FillBytes(make([]byte, 32))...)
+		blob = appendSSHString(blob, []byte(sshECDSAP256))
+		blob = appendSSHString(blob, []byte("nistp256"))
+		return appendSSHString(blob, point)
+	}
+	return nil
+}
+
+func parseSSHKeyBlob(blob []byte) PublicKey {
+	r := &sshReader{data: blob}
+	switch string(r.string()) {
+	case sshEd25519:
+		if raw := r.string(); r.err == nil && Ed25519.IsValidPublicKey(raw) {
+			return newSchemeKey(Ed25519, raw)
+		}
+	case sshECDSAP256:
+		if r.string(); r.err == nil {
+			if point := r.string(); r.err == nil && len(point) == 65 && point[0] == 4 {
+				x, y := new(big.Int).SetBytes(point[1:33]), new(big.Int).SetBytes(point[33:])
+				raw := elliptic.MarshalCompressed(elliptic.P256(), x, y)
+				if x1, y1 := elliptic.UnmarshalCompressed(elliptic.P256(), raw); x1 != nil && y1.Cmp(y) == 0 { // (the point is on the curve)
+					return newSchemeKey(ECDSAP256, raw)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func appendSSHString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// sshReader reads ssh wire encoded values; the first error is kept
+type sshReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sshReader) next(n int) []byte {
+	if r.err != nil || n > len(r.data) {
+		r.err = errAgentResponse
+		return nil
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *sshReader) byte() byte {
+	if v := r.next(1); v != nil {
+		return v[0]
+	}
+	return 0
+}
+
+func (r *sshReader) uint32() uint32 {
+	if v := r.next(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (r *sshReader) string() []byte {
+	n := r.uint32()
+	if n > uint32(len(r.data)) { // (compared before the conversion: int(n) can overflow on 32-bit platforms)
+		r.err = errAgentResponse
+		return nil
+	}
+	return bytes.Clone(r.next(int(n)))
+}
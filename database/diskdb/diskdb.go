@@ -0,0 +1,409 @@
+package diskdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/indifs/indifs/database"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// diskDB implements database.Storage on top of a local directory.
+//
+// Every table is a sub-directory of the root:
+//
+//	<table>/data/...   – committed values (see keyPath)
+//	<table>/tx/        – values staged by a running transaction
+//	<table>/journal    – list of operations of a committed transaction
+//
+// A transaction writes its values to the staging directory, then atomically
+// renames the journal into place and only after that moves staged files to
+// the data directory. If the process crashes in between, the journal is
+// replayed the next time the table is opened; staged files without a
+// journal are discarded.
+type diskDB struct {
+	dir  string
+	mx   sync.Mutex
+	tabs map[string]*diskTab
+}
+
+type diskTab struct {
+	txMx    sync.Mutex   // serializes transactions
+	mx      sync.RWMutex // guards committed data; held by writers only while a transaction is applied
+	dir     string
+	dropped bool // the table is dropped; the tab can`t be used anymore (guarded by txMx and mx)
+}
+
+// diskTx implements database.Transaction
+type diskTx struct {
+	tab *diskTab
+	ops map[string]string // key -> staged file name ("" – delete key)
+	seq int
+}
+
+const (
+	dirData     = "data"
+	dirTx       = "tx"
+	fileJournal = "journal"
+
+	opPut    = 'P'
+	opDelete = 'D'
+)
+
+var errDropped = errors.New("diskdb: table is dropped")
+
+// Open opens (or creates) a disk storage in the given directory.
+func Open(dir string) (database.Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &diskDB{dir: dir, tabs: map[string]*diskTab{}}, nil
+}
+
+func (s *diskDB) tab(table string, create bool) (t *diskTab, err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if t = s.tabs[table]; t != nil {
+		return
+	}
+	dir := s.tableDir(table)
+	if _, err = os.Stat(dir); os.IsNotExist(err) && !create {
+		return nil, database.ErrNotFound
+	} else if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if err = os.MkdirAll(filepath.Join(dir, dirData), 0755); err != nil {
+		return
+	}
+	t = &diskTab{dir: dir}
+	if err = t.recover(); err != nil {
+		return nil, err
+	}
+	s.tabs[table] = t
+	return
+}
+
+func (s *diskDB) Drop(table string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	t := s.tabs[table]
+	if t != nil {
+		t.txMx.Lock()
+		defer t.txMx.Unlock()
+		t.mx.Lock()
+		defer t.mx.Unlock()
+		t.dropped = true // callers holding the tab fail
+	}
+	delete(s.tabs, table)
+
+	dir := s.tableDir(table)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	// rename first, so a crash during RemoveAll can't leave a half-deleted table
+	tmp, err := os.MkdirTemp(s.dir, ".drop-")
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(dir, filepath.Join(tmp, "t")); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(s.dir)
+	return os.RemoveAll(tmp)
+}
+
+func (s *diskDB) OpenAt(table, key string, offset int64) (io.ReadCloser, error) {
+	tab, err := s.tab(table, false)
+	if err != nil {
+		return nil, err
+	}
+	tab.mx.RLock()
+	defer tab.mx.RUnlock()
+	if tab.dropped {
+		return nil, database.ErrNotFound
+	}
+	return tab.openAt(key, offset)
+}
+
+func (s *diskDB) Keys(table, prefix string) (keys []string, err error) {
+	tab, err := s.tab(table, false)
+	if err == database.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	tab.mx.RLock()
+	defer tab.mx.RUnlock()
+	if tab.dropped {
+		return nil, nil
+	}
+
+	root := filepath.Join(tab.dir, dirData)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key, err := pathKey(rel)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return
+}
+
+func (s *diskDB) Execute(table string, fn func(database.Transaction) error) (err error) {
+	tab, err := s.tab(table, true)
+	if err != nil {
+		return
+	}
+	tab.txMx.Lock()
+	defer tab.txMx.Unlock()
+	if tab.dropped { // the table is dropped while waiting for the lock
+		return errDropped
+	}
+
+	// finish previous transaction if it has failed to apply
+	if err = tab.apply(); err != nil {
+		return
+	}
+	txDir := filepath.Join(tab.dir, dirTx)
+	if err = os.MkdirAll(txDir, 0755); err != nil {
+		return
+	}
+	tx := &diskTx{tab: tab, ops: map[string]string{}}
+	err = func() (err error) {
+		defer recoverError(&err)
+		return fn(tx)
+	}()
+	if err != nil {
+		os.RemoveAll(txDir)
+		return err
+	}
+	return tab.commit(tx.ops)
+}
+
+func (s *diskDB) tableDir(table string) string {
+	return filepath.Join(s.dir, escapeName(table)+suffixDir)
+}
+
+func (t *diskTab) openAt(key string, offset int64) (io.ReadCloser, error) {
+	return openFileAt(filepath.Join(t.dir, dirData, keyPath(key)), offset)
+}
+
+func openFileAt(path string, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, database.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if st, err := f.Stat(); err != nil || offset > st.Size() {
+		f.Close()
+		if err == nil {
+			err = database.ErrNotFound
+		}
+		return nil, err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// commit makes the transaction durable by writing the journal, then applies it.
+func (t *diskTab) commit(ops map[string]string) error {
+	if len(ops) > 0 {
+		if err := t.writeJournal(ops); err != nil {
+			return err
+		}
+	}
+	return t.apply()
+}
+
+// apply applies the journal of the committed transaction (see recover)
+func (t *diskTab) apply() error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.recover()
+}
+
+func (t *diskTab) writeJournal(ops map[string]string) (err error) {
+	tmp := filepath.Join(t.dir, fileJournal+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(f)
+	for key, staged := range ops {
+		if staged != "" {
+			fmt.Fprintf(w, "%c %s %s\n", opPut, staged, escapeName(key))
+		} else {
+			fmt.Fprintf(w, "%c %s\n", opDelete, escapeName(key))
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return
+	}
+	if err = os.Rename(tmp, filepath.Join(t.dir, fileJournal)); err != nil {
+		return
+	}
+	syncDir(t.dir)
+	return
+}
+
+// recover replays the journal (if any) and removes stale staged values.
+func (t *diskTab) recover() error {
+	journal := filepath.Join(t.dir, fileJournal)
+	data, err := os.ReadFile(journal)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	dirs := map[string]bool{} // changed directories
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if err = t.applyOp(line, dirs); err != nil {
+			return fmt.Errorf("diskdb: can't apply journal of %s: %w", t.dir, err)
+		}
+	}
+	if data != nil {
+		// the renames and removes are durable before the journal is removed
+		for dir := range dirs {
+			syncDir(dir)
+		}
+		if err = os.Remove(journal); err != nil {
+			return err
+		}
+		syncDir(t.dir)
+	}
+	return os.RemoveAll(filepath.Join(t.dir, dirTx))
+}
+
+// applyOp applies the journal record; adds the changed directories (with their parents up to the data directory) to dirs
+func (t *diskTab) applyOp(line string, dirs map[string]bool) error {
+	ss := strings.Split(line, " ")
+	switch {
+	case len(ss) == 3 && ss[0] == string(opPut):
+		key, err := unescapeName(ss[2])
+		if err != nil {
+			return err
+		}
+		staged := filepath.Join(t.dir, dirTx, ss[1])
+		if _, err = os.Stat(staged); os.IsNotExist(err) { // has been applied already
+			return nil
+		}
+		path := filepath.Join(t.dir, dirData, keyPath(key))
+		t.addDirs(dirs, filepath.Dir(path)) // (including the directories made by MkdirAll)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.Rename(staged, path)
+
+	case len(ss) == 2 && ss[0] == string(opDelete):
+		key, err := unescapeName(ss[1])
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(t.dir, dirData, keyPath(key))
+		t.addDirs(dirs, filepath.Dir(path)) // (including the parents of the removed empty directories)
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		t.removeEmptyDirs(filepath.Dir(path))
+		return nil
+	}
+	return fmt.Errorf("invalid journal record %q", line)
+}
+
+func (t *diskTab) addDirs(dirs map[string]bool, dir string) {
+	root := filepath.Join(t.dir, dirData)
+	for ; dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		dirs[dir] = true
+	}
+	dirs[root] = true
+}
+
+func (t *diskTab) removeEmptyDirs(dir string) {
+	root := filepath.Join(t.dir, dirData)
+	for dir != root && strings.HasPrefix(dir, root) && os.Remove(dir) == nil {
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (tx *diskTx) OpenAt(key string, offset int64) (io.ReadCloser, error) {
+	staged, ok := tx.ops[key]
+	if !ok {
+		return tx.tab.openAt(key, offset)
+	}
+	if staged == "" { // deleted
+		return nil, database.ErrNotFound
+	}
+	return openFileAt(filepath.Join(tx.tab.dir, dirTx, staged), offset)
+}
+
+func (tx *diskTx) Put(key string, n int64, r io.Reader) (err error) {
+	tx.seq++
+	name := strconv.Itoa(tx.seq)
+	f, err := os.Create(filepath.Join(tx.tab.dir, dirTx, name))
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+	}()
+	if _, err = io.Copy(f, io.LimitReader(r, n)); err != nil {
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+	tx.ops[key] = name
+	return
+}
+
+func (tx *diskTx) Delete(key string) error {
+	tx.ops[key] = ""
+	return nil
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync() // not supported on some platforms; best effort
+		d.Close()
+	}
+}
+
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%v", r)
+	}
+}
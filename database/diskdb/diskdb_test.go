@@ -0,0 +1,205 @@
+package diskdb
+
+import (
+	"errors"
+	"github.com/indifs/indifs/database"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiskDB_Execute(t *testing.T) {
+	db := newTestDB(t)
+
+	err := db.Execute("tab", func(tx database.Transaction) error {
+		must(tx.Put("/A/1.txt", 5, strings.NewReader("Hello, World")))
+		must(tx.Put("/A/1", 3, strings.NewReader("abc")))
+		must(tx.Put("/A/1/2.txt", 3, strings.NewReader("def")))
+		must(tx.Put(".", 2, strings.NewReader("[]")))
+		return nil
+	})
+	assert(t, err == nil)
+
+	assert(t, readKey(db, "tab", "/A/1.txt", 0) == "Hello")
+	assert(t, readKey(db, "tab", "/A/1.txt", 3) == "lo")
+	assert(t, readKey(db, "tab", "/A/1.txt", 5) == "")
+	assert(t, readKey(db, "tab", "/A/1", 0) == "abc")
+	assert(t, readKey(db, "tab", "/A/1/2.txt", 0) == "def")
+	assert(t, readKey(db, "tab", ".", 0) == "[]")
+	assert(t, strings.Join(mustVal(database.Keys(db, "tab", "")), " ") == ". /A/1 /A/1.txt /A/1/2.txt")
+	assert(t, strings.Join(mustVal(database.Keys(db, "tab", "/A/1/")), " ") == "/A/1/2.txt")
+
+	_, err = db.OpenAt("tab", "/A/1.txt", 6)
+	assert(t, err == database.ErrNotFound)
+	_, err = db.OpenAt("tab", "/A/2.txt", 0)
+	assert(t, err == database.ErrNotFound)
+	_, err = db.OpenAt("unknown-tab", "/A/1.txt", 0)
+	assert(t, err == database.ErrNotFound)
+
+	//--- delete
+	err = db.Execute("tab", func(tx database.Transaction) error {
+		return tx.Delete("/A/1/2.txt")
+	})
+	assert(t, err == nil)
+	_, err = db.OpenAt("tab", "/A/1/2.txt", 0)
+	assert(t, err == database.ErrNotFound)
+	assert(t, readKey(db, "tab", "/A/1", 0) == "abc")
+}
+
+func TestDiskDB_Execute_rollback(t *testing.T) {
+	db := newTestDB(t)
+
+	err := db.Execute("tab", func(tx database.Transaction) error {
+		must(tx.Put("/a.txt", 3, strings.NewReader("abc")))
+		return errors.New("tx-error")
+	})
+	assert(t, err != nil)
+	_, err = db.OpenAt("tab", "/a.txt", 0)
+	assert(t, err == database.ErrNotFound)
+
+	err = db.Execute("tab", func(tx database.Transaction) error {
+		must(tx.Put("/a.txt", 3, strings.NewReader("abc")))
+		panic("tx-panic")
+	})
+	assert(t, err != nil)
+	_, err = db.OpenAt("tab", "/a.txt", 0)
+	assert(t, err == database.ErrNotFound)
+}
+
+func TestDiskDB_Execute_readCommitted(t *testing.T) {
+	db := newTestDB(t)
+	must(db.Execute("tab", func(tx database.Transaction) error {
+		return tx.Put("/a.txt", 3, strings.NewReader("abc"))
+	}))
+
+	// committed values are readable while a transaction is running
+	err := db.Execute("tab", func(tx database.Transaction) error {
+		must(tx.Put("/a.txt", 3, strings.NewReader("def")))
+		assert(t, readKey(db, "tab", "/a.txt", 0) == "abc")
+		return nil
+	})
+	assert(t, err == nil)
+	assert(t, readKey(db, "tab", "/a.txt", 0) == "def")
+}
+
+func TestDiskDB_recover(t *testing.T) {
+	dir := t.TempDir()
+	db := mustVal(Open(dir))
+	must(db.Execute("tab", func(tx database.Transaction) error {
+		return tx.Put("/a.txt", 3, strings.NewReader("abc"))
+	}))
+
+	// emulate the crash before the journal has been written
+	tx := newTestTx(db, "tab")
+	must(tx.Put("/b.txt", 3, strings.NewReader("def")))
+	must(tx.Delete("/a.txt"))
+
+	db = mustVal(Open(dir)) // reopen db; tx is discarded
+	assert(t, readKey(db, "tab", "/a.txt", 0) == "abc")
+	_, err := db.OpenAt("tab", "/b.txt", 0)
+	assert(t, err == database.ErrNotFound)
+
+	// emulate the crash after the journal has been written
+	tx = newTestTx(db, "tab")
+	must(tx.Put("/b.txt", 3, strings.NewReader("def")))
+	must(tx.Delete("/a.txt"))
+	must(tx.tab.writeJournal(tx.ops))
+
+	db = mustVal(Open(dir)) // reopen db; tx is applied
+	assert(t, readKey(db, "tab", "/b.txt", 0) == "def")
+	_, err = db.OpenAt("tab", "/a.txt", 0)
+	assert(t, err == database.ErrNotFound)
+}
+
+func TestDiskDB_Drop(t *testing.T) {
+	dir := t.TempDir()
+	db := mustVal(Open(dir))
+	must(db.Execute("tab", func(tx database.Transaction) error {
+		return tx.Put("/a.txt", 3, strings.NewReader("abc"))
+	}))
+
+	err := db.Drop("tab")
+	assert(t, err == nil)
+
+	_, err = db.OpenAt("tab", "/a.txt", 0)
+	assert(t, err == database.ErrNotFound)
+
+	dd, _ := os.ReadDir(dir)
+	assert(t, len(dd) == 0)
+}
+
+func TestDiskDB_Drop_staleTab(t *testing.T) {
+	dir := t.TempDir()
+	db := mustVal(Open(dir)).(*diskDB)
+	must(db.Execute("tab", func(tx database.Transaction) error {
+		return tx.Put("/a.txt", 3, strings.NewReader("abc"))
+	}))
+	tab := mustVal(db.tab("tab", false))
+	must(db.Drop("tab"))
+	assert(t, tab.dropped)
+
+	// the tab is still held by a caller (e.g. waiting for the lock of the transaction)
+	db.tabs["tab"] = tab
+	err := db.Execute("tab", func(tx database.Transaction) error {
+		return tx.Put("/b.txt", 3, strings.NewReader("def"))
+	})
+	assert(t, errors.Is(err, errDropped))
+	_, err = db.OpenAt("tab", "/a.txt", 0)
+	assert(t, err == database.ErrNotFound)
+	assert(t, len(mustVal(db.Keys("tab", ""))) == 0)
+
+	dd, _ := os.ReadDir(dir) // the table is not recreated
+	assert(t, len(dd) == 0)
+}
+
+func Test_keyPath(t *testing.T) {
+	assert(t, keyPath("/A/1.txt") == filepath.Join("+", "A+", "1.txt.v"))
+	assert(t, keyPath(".") == "..v")
+	assert(t, keyPath("/Hello, 世界") == filepath.Join("+", "Hello%2C%20%E4%B8%96%E7%95%8C.v"))
+
+	long := strings.Repeat("世", 100)
+	path := keyPath("/" + long)
+	for _, name := range strings.Split(path, string(filepath.Separator)) {
+		assert(t, len(name) <= maxNameChunk+len(suffixFile))
+	}
+	name := strings.ReplaceAll(path, string(filepath.Separator), "")
+	name = strings.ReplaceAll(name, suffixChunk, "")
+	name = strings.TrimSuffix(strings.TrimPrefix(name, suffixDir), suffixFile)
+	assert(t, mustVal(unescapeName(name)) == long)
+	assert(t, mustVal(pathKey(path)) == "/"+long)
+}
+
+func newTestDB(t *testing.T) database.Storage {
+	return mustVal(Open(t.TempDir()))
+}
+
+func newTestTx(db database.Storage, table string) *diskTx {
+	tab := mustVal(db.(*diskDB).tab(table, true))
+	must(os.MkdirAll(filepath.Join(tab.dir, dirTx), 0755))
+	return &diskTx{tab: tab, ops: map[string]string{}}
+}
+
+func readKey(db database.Storage, table, key string, offset int64) string {
+	r := mustVal(db.OpenAt(table, key, offset))
+	defer r.Close()
+	return string(mustVal(io.ReadAll(r)))
+}
+
+func assert(t *testing.T, ok bool) {
+	if !ok {
+		t.Fatal("assertion failed")
+	}
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func mustVal[T any](v T, err error) T {
+	must(err)
+	return v
+}
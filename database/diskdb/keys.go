@@ -0,0 +1,122 @@
+package diskdb
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	maxNameChunk = 200 // max length of an escaped name-chunk (file names are limited by 255 bytes)
+
+	suffixDir   = "+"  // directory made from a full key-segment
+	suffixChunk = "~"  // directory made from a part of a long key-segment
+	suffixFile  = ".v" // value file
+)
+
+var errInvalidName = errors.New("diskdb: invalid escaped name")
+
+// keyPath maps a key to a relative file path.
+//
+// Key segments separated by '/' become directories (so "/A/1.txt" is stored as "+/A+/1.txt.v").
+// Directory and file names get different suffixes, which are escaped in the names themselves,
+// so the keys "/a" and "/a/b" never collide.
+func keyPath(key string) string {
+	segments := strings.Split(key, "/")
+	var parts []string
+	for i, seg := range segments {
+		name := escapeName(seg)
+		for len(name) > maxNameChunk {
+			n := maxNameChunk
+			if i := strings.LastIndexByte(name[n-2:n], '%'); i >= 0 { // don't split escape sequence
+				n = n - 2 + i
+			}
+			parts, name = append(parts, name[:n]+suffixChunk), name[n:]
+		}
+		if i < len(segments)-1 {
+			parts = append(parts, name+suffixDir)
+		} else {
+			parts = append(parts, name+suffixFile)
+		}
+	}
+	return filepath.Join(parts...)
+}
+
+// pathKey is the reverse of keyPath
+func pathKey(path string) (string, error) {
+	var b strings.Builder
+	for _, name := range strings.Split(filepath.ToSlash(path), "/") {
+		var suffix string
+		switch {
+		case strings.HasSuffix(name, suffixDir):
+			name, suffix = strings.TrimSuffix(name, suffixDir), "/"
+		case strings.HasSuffix(name, suffixChunk):
+			name = strings.TrimSuffix(name, suffixChunk)
+		case strings.HasSuffix(name, suffixFile):
+			name = strings.TrimSuffix(name, suffixFile)
+		default:
+			return "", errInvalidName
+		}
+		s, err := unescapeName(name)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+		b.WriteString(suffix)
+	}
+	return b.String(), nil
+}
+
+// escapeName escapes all bytes except [a-zA-Z0-9_.-] as %XX
+func escapeName(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; isSafeChar(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+func unescapeName(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '%' {
+			if !isSafeChar(c) {
+				return "", errInvalidName
+			}
+			b.WriteByte(c)
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", errInvalidName
+		}
+		hi, lo := unhex(s[i+1]), unhex(s[i+2])
+		if hi < 0 || lo < 0 {
+			return "", errInvalidName
+		}
+		b.WriteByte(byte(hi<<4 | lo))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+func isSafeChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
+
+func unhex(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'F':
+		return int(c - 'A' + 10)
+	}
+	return -1
+}
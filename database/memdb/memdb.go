@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/indifs/indifs/database"
 	"io"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -15,12 +17,16 @@ type memDB struct {
 }
 
 type memTab struct {
-	mx   sync.RWMutex
+	txMx sync.Mutex   // serializes transactions
+	mx   sync.RWMutex // guards data; held by writers only while a transaction is merged
 	data map[string][]byte
 }
 
 // memTx implements db.Transaction
-type memTx map[string][]byte
+type memTx struct {
+	tab  *memTab
+	data map[string][]byte
+}
 
 func New() database.Storage {
 	return &memDB{tabs: map[string]*memTab{}}
@@ -66,13 +72,29 @@ func (s *memDB) OpenAt(table, key string, offset int64) (r io.ReadCloser, err er
 	return io.NopCloser(bytes.NewReader(data[offset:])), nil
 }
 
+func (s *memDB) Keys(table, prefix string) (keys []string, err error) {
+	tab := s.rTab(table)
+	if tab == nil {
+		return
+	}
+	tab.mx.RLock()
+	defer tab.mx.RUnlock()
+	for key := range tab.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return
+}
+
 func (s *memDB) Execute(table string, fn func(database.Transaction) error) (err error) {
 	tab := s.tab(table)
 
-	tab.mx.Lock()
-	defer tab.mx.Unlock()
+	tab.txMx.Lock()
+	defer tab.txMx.Unlock()
 
-	tx := memTx{}
+	tx := memTx{tab: tab, data: map[string][]byte{}}
 	err = func() (err error) {
 		defer recoverError(&err)
 		return fn(tx)
@@ -80,7 +102,9 @@ func (s *memDB) Execute(table string, fn func(database.Transaction) error) (err
 	if err != nil {
 		return err
 	}
-	for key, val := range tx { // merge tx-data
+	tab.mx.Lock()
+	defer tab.mx.Unlock()
+	for key, val := range tx.data { // merge tx-data
 		if val != nil {
 			tab.data[key] = val
 		} else {
@@ -90,13 +114,24 @@ func (s *memDB) Execute(table string, fn func(database.Transaction) error) (err
 	return nil
 }
 
+func (tx memTx) OpenAt(key string, offset int64) (io.ReadCloser, error) {
+	data, ok := tx.data[key]
+	if !ok {
+		data, ok = tx.tab.data[key]
+	}
+	if !ok || data == nil || offset > int64(len(data)) {
+		return nil, database.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data[offset:])), nil
+}
+
 func (tx memTx) Put(key string, n int64, r io.Reader) (err error) {
-	tx[key], err = io.ReadAll(io.LimitReader(r, n))
+	tx.data[key], err = io.ReadAll(io.LimitReader(r, n))
 	return
 }
 
 func (tx memTx) Delete(key string) error {
-	tx[key] = nil
+	tx.data[key] = nil
 	return nil
 }
 
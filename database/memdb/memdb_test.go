@@ -0,0 +1,74 @@
+package memdb
+
+import (
+	"github.com/indifs/indifs/database"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMemDB_Execute_readCommitted(t *testing.T) {
+	db := New()
+	must(db.Execute("tab", func(tx database.Transaction) error {
+		return tx.Put("/a.txt", 3, strings.NewReader("abc"))
+	}))
+
+	// committed values are readable while a transaction is running
+	err := db.Execute("tab", func(tx database.Transaction) error {
+		must(tx.Put("/a.txt", 3, strings.NewReader("def")))
+		assert(t, readKey(db, "tab", "/a.txt") == "abc")
+		return nil
+	})
+	assert(t, err == nil)
+	assert(t, readKey(db, "tab", "/a.txt") == "def")
+}
+
+func TestMemDB_Execute_serialized(t *testing.T) {
+	db := New()
+	must(db.Execute("tab", func(tx database.Transaction) error {
+		return tx.Put("n", 1, strings.NewReader("0"))
+	}))
+
+	// concurrent transactions don't lose updates
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			must(db.Execute("tab", func(tx database.Transaction) error {
+				r := mustVal(tx.OpenAt("n", 0))
+				n := mustVal(strconv.Atoi(string(mustVal(io.ReadAll(r)))))
+				r.Close()
+				s := strconv.Itoa(n + 1)
+				return tx.Put("n", int64(len(s)), strings.NewReader(s))
+			}))
+		}()
+	}
+	wg.Wait()
+	assert(t, readKey(db, "tab", "n") == "50")
+}
+
+func readKey(db database.Storage, table, key string) string {
+	r := mustVal(db.OpenAt(table, key, 0))
+	defer r.Close()
+	return string(mustVal(io.ReadAll(r)))
+}
+
+func assert(t *testing.T, ok bool) {
+	if !ok {
+		t.Fatal("assertion failed")
+	}
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func mustVal[T any](v T, err error) T {
+	must(err)
+	return v
+}
@@ -11,9 +11,31 @@ type Storage interface {
 	Drop(table string) error
 }
 
+// KeyLister is an optional interface of Storage listing keys of a table
+type KeyLister interface {
+	// Keys returns sorted keys of the table with the prefix
+	Keys(table, prefix string) ([]string, error)
+}
+
 type Transaction interface {
+	// OpenAt opens value of the key; uncommitted changes of the transaction are visible.
+	// (It is required to count references in the shared parts-table,
+	// so Transaction implementations made before have to add it.)
+	OpenAt(key string, offset int64) (io.ReadCloser, error)
 	Put(key string, size int64, r io.Reader) error
 	Delete(key string) error
 }
 
-var ErrNotFound = errors.New("db-error: not found")
+var (
+	ErrNotFound     = errors.New("db-error: not found")
+	ErrNotSupported = errors.New("db-error: not supported")
+)
+
+// Keys returns sorted keys of the table with the prefix.
+// It returns ErrNotSupported if the storage doesn't implement KeyLister.
+func Keys(s Storage, table, prefix string) ([]string, error) {
+	if l, ok := s.(KeyLister); ok {
+		return l.Keys(table, prefix)
+	}
+	return nil, ErrNotSupported
+}
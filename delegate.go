@@ -0,0 +1,262 @@
+package indifs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"slices"
+	"strings"
+)
+
+// Delegation grants a public key (e.g. a sub-key, see crypto.PrivateKey.SubKey) permissions to change paths of the filesystem.
+//
+// Delegations are the access list of the filesystem; they are kept in the root-header fields
+//
+//	Delegate: <public-key> [<permission>,...] <dir-path> ...
+//
+// A writer signs the root-header with SignAsDelegate; headers changed by the writer keep its key in the field "Author".
+// Other fields of the root-header can be changed only by the owner.
+type Delegation struct {
+	PublicKey crypto.PublicKey
+	Perms     Permission
+	Paths     []string // granted directories (with all their content)
+}
+
+// Permission is a set of permissions of a delegation
+type Permission uint8
+
+const (
+	PermWrite  Permission = 1 << iota // create and change nodes
+	PermDelete                        // delete nodes
+	PermAdmin                         // grant and revoke permissions to the paths
+
+	defaultPerms = PermWrite | PermDelete // (permissions of a delegation without the permissions list)
+)
+
+var permNames = []string{"write", "delete", "admin"}
+
+const headerAuthor = "Author" // public key of the writer changed the node (see Delegation)
+
+// maxDelegateVerStep is the max increase of the version by a commit of a delegate
+// (the owner keeps room for following versions)
+const maxDelegateVerStep = 1 << 20
+
+var ErrNotAuthorized = errors.New("signer is not authorized")
+
+// root-header fields changed by a commit of a writer
+var delegateRootFields = map[string]bool{
+	headerVer:        true,
+	headerUpdated:    true,
+	headerVolume:     true,
+	headerMerkleHash: true,
+	headerInfoHash:   true,
+	headerSigner:     true,
+	headerSignature:  true,
+	headerDelegate:   true, // (changes of the access list are verified separately)
+}
+
+func (p Permission) String() string {
+	var ss []string
+	for i, name := range permNames {
+		if p&(1<<i) != 0 {
+			ss = append(ss, name)
+		}
+	}
+	return strings.Join(ss, ",")
+}
+
+func parsePermission(s string) (p Permission, ok bool) {
+	for _, name := range strings.Split(s, ",") {
+		i := slices.Index(permNames, name)
+		if i < 0 {
+			return 0, false
+		}
+		p |= 1 << i
+	}
+	return p, true
+}
+
+func (d Delegation) String() string {
+	return d.PublicKey.Encode() + " " + d.Perms.String() + " " + strings.Join(d.Paths, " ")
+}
+
+// Allows says the path is granted by the delegation with all the permissions
+func (d Delegation) Allows(path string, perms Permission) bool {
+	if d.Perms&perms != perms {
+		return false
+	}
+	for _, p := range d.Paths {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDelegation(s string) (d Delegation, ok bool) {
+	ss := strings.Fields(s)
+	if len(ss) < 2 {
+		return
+	}
+	if d.PublicKey = crypto.DecodePublicKey(ss[0]); d.PublicKey == nil {
+		return
+	}
+	d.Perms, ss = defaultPerms, ss[1:]
+	if !strings.HasPrefix(ss[0], "/") {
+		if d.Perms, ok = parsePermission(ss[0]); !ok || len(ss) < 2 {
+			return d, false
+		}
+		ss = ss[1:]
+	}
+	for _, path := range ss {
+		if !IsValidPath(path) || !isDir(path) {
+			return d, false
+		}
+	}
+	d.Paths = ss
+	return d, true
+}
+
+// Delegations returns the access list of the root-header
+func (h Header) Delegations() (dd []Delegation) {
+	for _, f := range h {
+		if f.Name == headerDelegate {
+			if d, ok := parseDelegation(string(f.Value)); ok {
+				dd = append(dd, d)
+			}
+		}
+	}
+	return
+}
+
+// SetDelegation grants the public key permissions to write and delete the paths; empty paths remove the delegation.
+func (h *Header) SetDelegation(pub crypto.PublicKey, paths ...string) {
+	h.SetGrant(pub, defaultPerms, paths...)
+}
+
+// SetGrant replaces delegations of the public key in the root-header; empty permissions or paths remove the delegations.
+func (h *Header) SetGrant(pub crypto.PublicKey, perms Permission, paths ...string) {
+	*h = sliceFilter(*h, func(f HeaderField) bool {
+		d, ok := parseDelegation(string(f.Value))
+		return f.Name != headerDelegate || ok && !d.PublicKey.Equal(pub)
+	})
+	if perms != 0 && len(paths) > 0 {
+		h.Add(headerDelegate, Delegation{pub, perms, paths}.String())
+	}
+}
+
+// Author returns the public key of the writer changed the node (nil if the node is changed by the owner)
+func (h Header) Author() crypto.PublicKey {
+	if !h.Has(headerAuthor) {
+		return nil
+	}
+	return crypto.DecodePublicKey(h.Get(headerAuthor))
+}
+
+func allows(acl []Delegation, pub crypto.PublicKey, path string, perms Permission) bool {
+	for _, d := range acl {
+		if d.PublicKey.Equal(pub) && d.Allows(path, perms) {
+			return true
+		}
+	}
+	return false
+}
+
+// commitAuthor returns the key of the writer signing the commit of the root-header by the signer (nil for the owner)
+func commitAuthor(root Header, signer crypto.Signer) crypto.PublicKey {
+	if pub, owner := signer.PublicKey(), root.Owner(); owner != nil && !owner.Equal(pub) {
+		return pub
+	}
+	return nil
+}
+
+// setAuthor sets Author of the header changed by the commit (deletes it for the owner)
+func setAuthor(h *Header, author crypto.PublicKey) {
+	if author == nil {
+		h.Delete(headerAuthor)
+	} else {
+		h.Set(headerAuthor, author.Encode())
+	}
+}
+
+// Delegate grants the public key permissions to write and delete the given directories (see Delegation);
+// no paths – revokes the delegation.
+func (b *CommitBuilder) Delegate(pub crypto.PublicKey, paths ...string) error {
+	return b.Grant(pub, defaultPerms, paths...)
+}
+
+// Grant replaces permissions of the public key to the given directories (see Delegation);
+// empty permissions or paths – revokes the delegation.
+func (b *CommitBuilder) Grant(pub crypto.PublicKey, perms Permission, paths ...string) (err error) {
+	defer recoverError(&err)
+	require(isValidPublicKey(pub) && !slices.ContainsFunc(ownerKeys(b.root), pub.Equal), errInvalidPublicKey)
+	for _, path := range paths {
+		require(IsValidPath(path) && isDir(path), errInvalidPath)
+	}
+	b.root.SetGrant(pub, perms, paths...)
+	return
+}
+
+// verifyDelegatedCommit verifies the commit root-header c signed by a writer of the access list of the current root-header r.
+// All nodes changed or removed by the new tree are verified, including the nodes removed implicitly
+// (e.g. children of a directory of the new version missing in the commit).
+func (f *fileSystem) verifyDelegatedCommit(r, c Header, newTree map[string]*fsNode) {
+	signer := c.Signer()
+	acl := r.Delegations()
+	require(sliceFilter(acl, func(d Delegation) bool { return d.PublicKey.Equal(signer) }) != nil, ErrNotAuthorized)
+	require(exceptFields(c, delegateRootFields).String() == exceptFields(r, delegateRootFields).String(), ErrNotAuthorized)
+
+	//--- changes of the access list
+	oldACL, newACL := fieldValues(r, headerDelegate), fieldValues(c, headerDelegate)
+	for v := range oldACL {
+		if !newACL[v] {
+			newACL[v] = true
+		} else {
+			delete(newACL, v)
+		}
+	}
+	for v := range newACL { // added and removed delegations
+		d, ok := parseDelegation(v)
+		require(ok, errInvalidHeader)
+		for _, path := range d.Paths {
+			require(allows(acl, signer, path, PermAdmin), ErrNotAuthorized)
+		}
+	}
+
+	//--- changed and added nodes
+	author := signer.Encode()
+	for path, nd := range newTree {
+		h, cur := nd.Header, f.nodes[path]
+		if path == "" || cur != nil && bytes.Equal(cur.Header.Hash(), h.Hash()) { // unchanged
+			continue
+		}
+		require(h.Ver() == c.Ver() && h.Get(headerAuthor) == author, ErrNotAuthorized)
+		if h.Deleted() {
+			require(allows(acl, signer, path, PermDelete), ErrNotAuthorized)
+		} else {
+			require(allows(acl, signer, path, PermWrite), ErrNotAuthorized)
+		}
+	}
+	//--- removed nodes
+	for path := range f.nodes {
+		if path != "" && newTree[path] == nil {
+			require(allows(acl, signer, path, PermDelete), ErrNotAuthorized)
+		}
+	}
+}
+
+func exceptFields(h Header, fields map[string]bool) Header {
+	return sliceFilter(h, func(f HeaderField) bool {
+		return !fields[f.Name]
+	})
+}
+
+func fieldValues(h Header, name string) map[string]bool {
+	vv := map[string]bool{}
+	for _, f := range h {
+		if f.Name == name {
+			vv[string(f.Value)] = true
+		}
+	}
+	return vv
+}
@@ -0,0 +1,221 @@
+package indifs
+
+import (
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDelegation(t *testing.T) {
+	bot := testPrv.SubKey("build-bot")
+	s := applyCommit(newTestIFS(), "commit1")
+	s2 := applyCommit(newTestIFS(), "commit1") // replica
+
+	b := mustVal(NewCommitBuilder(s))
+	must(b.Delegate(bot.PublicKey(), "/releases/", "/docs/"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+	must(s2.Commit(mustVal(s.GetCommit(1))))
+
+	dd := s.Root().Delegations()
+	assert(t, len(dd) == 1 && dd[0].PublicKey.Equal(bot.PublicKey()))
+	assert(t, equal(dd[0].Paths, []string{"/releases/", "/docs/"}))
+
+	//--- the delegate publishes a release
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Put("/releases/v1.0/app.bin", strings.NewReader("binary")))
+	must(s.Commit(mustVal(b.Build(bot))))
+	assert(t, s.Root().Ver() == 3)
+	assert(t, s.Root().PublicKey().Equal(testPub))
+	assert(t, s.Root().Signer().Equal(bot.PublicKey()))
+	assert(t, testReadFile(s, "/releases/v1.0/app.bin") == "binary")
+	assert(t, mustVal(s.(Scrubber).Scrub(nil)).OK())
+
+	// the commit is replicated as usual
+	must(s2.Commit(mustVal(s.GetCommit(2))))
+	assert(t, equal(fsHeaders(s2), fsHeaders(s)))
+
+	//--- the delegate can`t change other paths and the root-header
+	for _, fn := range []func(b *CommitBuilder) error{
+		func(b *CommitBuilder) error { return b.Put("/readme.txt", strings.NewReader("hacked")) },
+		func(b *CommitBuilder) error { return b.Remove("/A/") },
+		func(b *CommitBuilder) error { return b.SetHeader("", "Title", "hacked") },
+		func(b *CommitBuilder) error { return b.Delegate(bot.PublicKey(), "/") },
+	} {
+		b = mustVal(NewCommitBuilder(s))
+		must(fn(b))
+		err := s.Commit(mustVal(b.Build(bot)))
+		assert(t, errors.Is(err, ErrNotAuthorized))
+	}
+
+	// unknown key
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Put("/releases/v2.0/app.bin", strings.NewReader("binary")))
+	err := s.Commit(mustVal(b.Build(crypto.NewPrivateKeyFromSeed("private-key-seed-2"))))
+	assert(t, errors.Is(err, ErrNotAuthorized))
+
+	//--- the owner changes the root-header and revokes the delegation
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Delegate(bot.PublicKey()))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+	assert(t, len(s.Root().Delegations()) == 0)
+	assert(t, s.Root().Signer() == nil)
+
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Put("/releases/v2.0/app.bin", strings.NewReader("binary")))
+	err = s.Commit(mustVal(b.Build(bot)))
+	assert(t, errors.Is(err, ErrNotAuthorized))
+
+	//--- errors
+	b = mustVal(NewCommitBuilder(s))
+	assert(t, errors.Is(b.Delegate(testPub, "/"), errInvalidPublicKey))
+	assert(t, errors.Is(b.Delegate(bot.PublicKey(), "/releases"), errInvalidPath))
+}
+
+func TestDelegation_permissions(t *testing.T) {
+	writer := testPrv.SubKey("writer")
+	admin := testPrv.SubKey("admin")
+	alice := testPrv.SubKey("alice")
+	s := applyCommit(newTestIFS(), "commit1")
+
+	b := mustVal(NewCommitBuilder(s))
+	must(b.Grant(writer.PublicKey(), PermWrite, "/releases/"))
+	must(b.Grant(admin.PublicKey(), PermAdmin|PermWrite, "/team/"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+
+	//--- write-only access
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Put("/releases/v1.txt", strings.NewReader("v1")))
+	must(s.Commit(mustVal(b.Build(writer))))
+	h := mustVal(s.FileHeader("/releases/v1.txt"))
+	assert(t, h.Author().Equal(writer.PublicKey()))
+	assert(t, mustVal(s.FileHeader("/releases/")).Author().Equal(writer.PublicKey()))
+
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Remove("/releases/v1.txt"))
+	err := s.Commit(mustVal(b.Build(writer)))
+	assert(t, errors.Is(err, ErrNotAuthorized))
+
+	//--- the admin grants access to the subdirectory
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Grant(alice.PublicKey(), PermWrite|PermDelete, "/team/alice/"))
+	must(b.Put("/team/alice/readme.txt", strings.NewReader("readme")))
+	must(s.Commit(mustVal(b.Build(admin))))
+	assert(t, len(s.Root().Delegations()) == 3)
+
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Put("/team/alice/notes.txt", strings.NewReader("notes")))
+	must(s.Commit(mustVal(b.Build(alice))))
+	assert(t, mustVal(s.FileHeader("/team/alice/notes.txt")).Author().Equal(alice.PublicKey()))
+
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Grant(alice.PublicKey(), PermWrite, "/releases/")) // out of the admin`s paths
+	err = s.Commit(mustVal(b.Build(admin)))
+	assert(t, errors.Is(err, ErrNotAuthorized))
+
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Grant(writer.PublicKey(), 0)) // revoke access to other paths
+	err = s.Commit(mustVal(b.Build(admin)))
+	assert(t, errors.Is(err, ErrNotAuthorized))
+
+	//--- changes of the owner have no Author
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Put("/releases/v1.txt", strings.NewReader("fixed")))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+	assert(t, mustVal(s.FileHeader("/releases/v1.txt")).Author() == nil)
+	assert(t, mustVal(s.(Scrubber).Scrub(nil)).OK())
+}
+
+func TestDelegation_version(t *testing.T) {
+	bot := testPrv.SubKey("build-bot")
+	s := applyCommit(newTestIFS(), "commit1")
+	b := mustVal(NewCommitBuilder(s))
+	must(b.Delegate(bot.PublicKey(), "/releases/"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+	hh := fsHeaders(s)
+	r := s.Root()
+
+	dir := NewHeader("/releases/")
+	setAuthor(&dir, bot.PublicKey())
+
+	// the commit of the current version replacing the whole tree by the delegate`s paths
+	dir.SetInt(headerVer, r.Ver())
+	var commit *Commit
+	for i := 0; commit == nil || !VersionIsGreater(commit.Root(), r); i++ { // the commit wins by hash
+		dir.SetInt("X-Nonce", int64(i))
+		commit = testSignedCommit(s, bot, r.Ver(), map[string]*fsNode{}, mustVal(s.FileHeader("/")), dir)
+	}
+	err := s.Commit(commit)
+	assert(t, errors.Is(err, ErrNotAuthorized))
+	assert(t, equal(fsHeaders(s), hh))
+
+	// the version is raised too far
+	ver := int64(math.MaxInt64 - 1)
+	dir.SetInt(headerVer, ver)
+	err = s.Commit(testSignedCommit(s, bot, ver, s.(*fileSystem).nodes, dir))
+	assert(t, errors.Is(err, ErrNotAuthorized))
+
+	dir.SetInt(headerVer, r.Ver()+1)
+	must(s.Commit(testSignedCommit(s, bot, r.Ver()+1, s.(*fileSystem).nodes, dir)))
+	assert(t, len(fsHeaders(s)) == len(hh)+1)
+}
+
+// testSignedCommit makes the commit of the headers hh of the version ver applied to the tree
+func testSignedCommit(s IFS, signer crypto.Signer, ver int64, tree map[string]*fsNode, hh ...Header) *Commit {
+	root := s.Root().Copy()
+	commit := &Commit{Headers: append([]Header{root}, hh...), Body: newMultiReader()}
+	sortHeaders(commit.Headers)
+	commit.Info = (&commitConfig{}).newInfo(root)
+	ndRoot := mustVal(indexTree(mergeHeaders(tree, commit.Headers)))[""]
+	newRoot := &commit.Headers[0]
+	newRoot.SetInt(headerVer, ver)
+	newRoot.SetTime(headerUpdated, root.Updated().Add(time.Hour))
+	newRoot.SetInt(headerVolume, ndRoot.totalVolume())
+	newRoot.SetBytes(headerMerkleHash, ndRoot.childrenMerkleRoot())
+	commit.signRoot(signer)
+	return commit
+}
+
+func TestDelegation_implicitRemoval(t *testing.T) {
+	writer := testPrv.SubKey("writer")
+	s := applyCommit(newTestIFS(), "commit1")
+	b := mustVal(NewCommitBuilder(s))
+	must(b.Grant(writer.PublicKey(), PermWrite, "/A/"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+	hh := fsHeaders(s)
+	ver := s.Root().Ver() + 1
+
+	// the directory of the new version without its children removes them
+	dir := mustVal(s.FileHeader("/A/")).Copy()
+	dir.SetInt(headerVer, ver)
+	setAuthor(&dir, writer.PublicKey())
+	commit := testSignedCommit(s, writer, ver, s.(*fileSystem).nodes, dir)
+	assert(t, len(commit.Headers) == 2)
+	err := s.Commit(commit)
+	assert(t, errors.Is(err, ErrNotAuthorized))
+	assert(t, equal(fsHeaders(s), hh))
+
+	// the children are kept
+	child := mustVal(s.FileHeader("/A/1.txt"))
+	commit = testSignedCommit(s, writer, ver, s.(*fileSystem).nodes, dir, child, mustVal(s.FileHeader("/A/2.txt")))
+	commit.Body = io.NopCloser(strings.NewReader(testReadFile(s, "/A/1.txt") + testReadFile(s, "/A/2.txt")))
+	must(s.Commit(commit))
+	assert(t, mustVal(s.FileHeader("/A/")).Get(headerAuthor) == writer.PublicKey().Encode())
+	assert(t, equal(mustVal(s.FileHeader("/A/1.txt")), child))
+
+	// the new tree without the nodes outside the grant of the delegate (e.g. the tree of the replaced version)
+	f := s.(*fileSystem)
+	dir.SetInt(headerVer, ver+1)
+	commit = testSignedCommit(s, writer, ver+1, f.nodes, dir, mustVal(s.FileHeader("/A/1.txt")), mustVal(s.FileHeader("/A/2.txt")))
+	newTree := mustVal(indexTree(mergeHeaders(map[string]*fsNode{}, append(commit.Headers, mustVal(s.FileHeader("/"))))))
+	assert(t, newTree["/A/1.txt"] != nil && newTree["/B/"] == nil)
+	err = func() (err error) {
+		defer recoverError(&err)
+		f.verifyDelegatedCommit(s.Root(), commit.Root(), newTree)
+		return
+	}()
+	assert(t, errors.Is(err, ErrNotAuthorized))
+}
@@ -0,0 +1,119 @@
+package indifs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"github.com/indifs/indifs/database"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Equivocation is a portable proof that the owner of a filesystem has signed two different root-headers of the same version.
+type Equivocation struct {
+	A Header `json:"a"` // known root-header
+	B Header `json:"b"` // conflicting root-header
+}
+
+const (
+	dbKeyEquivocationPrefix = ".e/"         // equivocation proofs by version
+	dbKeyDistrusted         = ".distrusted" // the key of the filesystem is not trusted (see WithEquivocationPolicy)
+)
+
+var (
+	ErrEquivocation  = errors.New("equivocation: different roots of the same version")
+	ErrUntrustedKey  = errors.New("public key of the filesystem is not trusted")
+	errInvalidProofs = errors.New("invalid equivocation proof")
+)
+
+// WithEquivocationPolicy sets the function deciding whether to trust the key of the filesystem
+// after the owner has signed two different root-headers of the same version.
+//
+// If fn returns false, the commit and all following commits are rejected (ErrEquivocation and ErrUntrustedKey).
+// By default the key is trusted and the root-header with the greater hash is accepted (see VersionIsGreater).
+// fn is called while the commit is applied and must not use the filesystem.
+func WithEquivocationPolicy(fn func(*Equivocation) (trust bool)) Option {
+	return func(f *fileSystem) {
+		f.equivocationPolicy = fn
+	}
+}
+
+// Ver returns the version of the conflicting root-headers
+func (e *Equivocation) Ver() int64 {
+	return e.A.Ver()
+}
+
+// Verify says both root-headers of the filesystem with the public key are signed by the same owner key
+// (see Header.Verify) for the same version and differ.
+// Root-headers signed by delegates are never proofs (see checkEquivocation), so they are not valid here.
+func (e *Equivocation) Verify(pub crypto.PublicKey) bool {
+	return e.A.IsRoot() && e.B.IsRoot() &&
+		e.A.Verify() && e.B.Verify() &&
+		e.A.PublicKey().Equal(pub) && e.B.PublicKey().Equal(pub) &&
+		e.A.Owner().Equal(e.B.Owner()) &&
+		e.A.Ver() == e.B.Ver() &&
+		!bytes.Equal(e.A.Hash(), e.B.Hash())
+}
+
+func equivocationKey(ver int64) string {
+	return dbKeyEquivocationPrefix + strconv.FormatInt(ver, 10)
+}
+
+func (f *fileSystem) Equivocations() (ee []*Equivocation, err error) {
+	defer recoverError(&err)
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+
+	for _, ver := range f.keyVersions(dbKeyEquivocationPrefix, f.Root().Ver()) {
+		var e *Equivocation
+		if f.dbGetJSON(equivocationKey(ver), &e); e != nil {
+			require(e.Verify(f.pub), errInvalidProofs)
+			ee = append(ee, e)
+		}
+	}
+	sort.Slice(ee, func(i, j int) bool {
+		return ee[i].Ver() < ee[j].Ver()
+	})
+	return
+}
+
+// checkEquivocation saves the proof if the commit root-header c conflicts with the known root-header of the same version.
+// Both root-headers have to be signed by the same owner key; c has to be authorized by the root-header of the previous version.
+func (f *fileSystem) checkEquivocation(c Header) {
+	if c.Ver() <= 0 || !c.PublicKey().Equal(f.pub) || !c.Verify() {
+		return
+	}
+	known := f.versionRoot(c.Ver())
+	if known == nil || bytes.Equal(known.Hash(), c.Hash()) || !known.Verify() || !known.Owner().Equal(c.Owner()) {
+		return
+	}
+	if !c.VerifyAuthority(f.prevRoot(c.Ver())) {
+		return
+	}
+	e := &Equivocation{A: known.Copy(), B: c.Copy()}
+	trust := f.equivocationPolicy == nil || f.equivocationPolicy(e)
+	must(f.db.Execute(f.id, func(tx database.Transaction) (err error) {
+		defer recoverError(&err)
+		if r, err := tx.OpenAt(equivocationKey(c.Ver()), 0); err == nil { // the first proof of the version is kept
+			r.Close()
+		} else {
+			putJSON(tx, equivocationKey(c.Ver()), e)
+		}
+		if !trust {
+			putJSON(tx, dbKeyDistrusted, true)
+		}
+		return
+	}))
+	if !trust {
+		f.distrusted = true
+		panic(ErrEquivocation)
+	}
+}
+
+func isServiceKey(key string) bool {
+	return strings.HasPrefix(key, dbKeyHistoryPrefix) ||
+		strings.HasPrefix(key, dbKeyEquivocationPrefix) ||
+		key == dbKeyDistrusted ||
+		key == dbKeyRetention
+}
@@ -0,0 +1,122 @@
+package indifs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"github.com/indifs/indifs/database/memdb"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConflictCommits returns two different commits of version 1 (a.Hash() < b.Hash())
+func testConflictCommits() (a, b *Commit) {
+	a = makeTestCommit(newTestIFS(), "commit1")
+	b = makeTestCommit(newTestIFS(), "commit1")
+	b.Headers[0].Add("X", "x")
+	must(b.Headers[0].Sign(testPrv))
+	if bytes.Compare(a.Hash(), b.Hash()) > 0 {
+		a, b = b, a
+	}
+	return
+}
+
+func TestFileSystem_Equivocations(t *testing.T) {
+	commitA, commitB := testConflictCommits()
+	s := newTestIFS()
+	must(s.Commit(commitA))
+	assert(t, len(mustVal(s.Equivocations())) == 0)
+
+	// the greater root-header is accepted by default; the proof is kept
+	must(s.Commit(commitB))
+	ee := mustVal(s.Equivocations())
+	assert(t, len(ee) == 1)
+	assert(t, ee[0].Ver() == 1 && ee[0].Verify(testPub))
+	assert(t, equal(ee[0].A, commitA.Root()) && equal(ee[0].B, commitB.Root()))
+
+	// the proof is portable
+	var e *Equivocation
+	must(json.Unmarshal([]byte(toJSON(ee[0])), &e))
+	assert(t, e.Verify(testPub))
+	assert(t, !e.Verify(crypto.NewPrivateKeyFromSeed("private-key-seed-2").PublicKey()))
+	e.B = e.A
+	assert(t, !e.Verify(testPub))
+
+	// root-headers signed by another key are not a proof against the owner
+	attacker := crypto.NewPrivateKeyFromSeed("attacker")
+	e = &Equivocation{A: commitA.Root().Copy(), B: commitB.Root().Copy()}
+	must(e.A.SignAsDelegate(attacker))
+	must(e.B.SignAsDelegate(attacker))
+	assert(t, !e.Verify(testPub))
+
+	// the conflict with a past version is detected too
+	commitA, commitB = testConflictCommits()
+	s = newTestIFS()
+	must(s.Commit(commitA))
+	applyCommit(s, "commit2")
+	assert(t, s.Commit(commitB) != nil)
+	assert(t, len(mustVal(s.Equivocations())) == 1)
+	assert(t, mustVal(s.(Scrubber).Scrub(nil)).OK())
+}
+
+func TestWithEquivocationPolicy(t *testing.T) {
+	commitA, commitB := testConflictCommits()
+	db := memdb.New()
+	var got *Equivocation
+	s := mustVal(OpenFS(testPub, db, WithEquivocationPolicy(func(e *Equivocation) bool {
+		got = e
+		return false
+	})))
+	must(s.Commit(commitA))
+
+	err := s.Commit(commitB)
+	assert(t, errors.Is(err, ErrEquivocation))
+	assert(t, got != nil && got.Verify(testPub))
+	assert(t, equal(s.Root(), commitA.Root()))
+
+	// the key is not trusted anymore
+	err = s.Commit(makeTestCommit(s, "commit2"))
+	assert(t, errors.Is(err, ErrUntrustedKey))
+
+	s = mustVal(OpenFS(testPub, db))
+	err = s.Commit(makeTestCommit(s, "commit2"))
+	assert(t, errors.Is(err, ErrUntrustedKey))
+	assert(t, len(mustVal(s.Equivocations())) == 1)
+}
+
+func TestFileSystem_Equivocations_unauthorized(t *testing.T) {
+	bot := testPrv.SubKey("build-bot")
+	called := false
+	s := mustVal(OpenFS(testPub, memdb.New(), WithEquivocationPolicy(func(e *Equivocation) bool {
+		called = true
+		return false
+	})))
+	applyCommit(s, "commit1")
+	b := mustVal(NewCommitBuilder(s))
+	must(b.Delegate(bot.PublicKey(), "/releases/"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+	prev := mustVal(s.OpenVersion(2))
+	defer prev.(io.Closer).Close()
+
+	// the delegate signs two different root-headers of version 3
+	newCommit := func(content string) *Commit {
+		b := mustVal(NewCommitBuilder(prev))
+		must(b.Put("/releases/app.bin", strings.NewReader(content)))
+		return mustVal(b.Build(bot, WithTime(testCommitTime.Add(time.Hour))))
+	}
+	must(s.Commit(newCommit("v1")))
+	s.Commit(newCommit("v2"))
+	assert(t, !called)
+	assert(t, len(mustVal(s.Equivocations())) == 0)
+
+	// a root-header of version 3 forged by an unknown key
+	c := newCommit("v3")
+	must(c.Headers[0].SignAsDelegate(crypto.NewPrivateKeyFromSeed("attacker")))
+	assert(t, s.Commit(c) != nil)
+	assert(t, !called)
+	assert(t, len(mustVal(s.Equivocations())) == 0)
+	assert(t, s.Root().Signer().Equal(bot.PublicKey()))
+}
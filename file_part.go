@@ -0,0 +1,100 @@
+package indifs
+
+import (
+	"bytes"
+	"github.com/indifs/indifs/crypto"
+	"io"
+)
+
+// FilePart is a single part of file content with proofs of its integrity.
+//
+// The proofs chain the part hash to the file Merkle (PartProof) and the file header
+// to the root-header Merkle (HeaderProof), so the part can be validated by anyone
+// holding only the signed root-header (see FilePart.Verify).
+type FilePart struct {
+	Header      Header // file header
+	Index       int    // part index
+	Data        []byte // part content
+	PartProof   []byte // merkle-proof of the part hash for the file Merkle
+	HeaderProof []byte // merkle-proof of the file header for the root-header Merkle
+}
+
+// Verify verifies the part against the root-header signed by the owner (see Header.Verify).
+// The root-header signed by a delegate is not valid here; use VerifyAuthority with the previous root-header.
+func (p *FilePart) Verify(root Header) bool {
+	return root.Verify() && p.verify(root)
+}
+
+// VerifyAuthority verifies the part against the root-header signed by the owner
+// or by a delegate of the previous root-header prev (see Header.VerifyAuthority).
+func (p *FilePart) VerifyAuthority(root, prev Header) bool {
+	return root.VerifyAuthority(prev) && p.verify(root)
+}
+
+func (p *FilePart) verify(root Header) bool {
+	h := p.Header
+	if !root.IsRoot() || !h.IsFile() || h.Deleted() {
+		return false
+	}
+	if !h.VerifyMerkleProof(root.MerkleHash(), p.HeaderProof) {
+		return false
+	}
+	partSize := h.PartSize()
+	if !h.Has(headerFilePartSize) {
+		if partSize = root.PartSize(); partSize <= 0 {
+			partSize = DefaultFilePartSize
+		}
+	}
+	size := h.FileSize()
+	if partSize <= 0 || size <= 0 || int64(len(p.Data)) != min(partSize, size-int64(p.Index)*partSize) {
+		return false
+	}
+	n := int((size + partSize - 1) / partSize)
+	return crypto.VerifyMerkleProofAt(crypto.Hash(p.Data), h.MerkleHash(), p.PartProof, p.Index, n)
+}
+
+func (f *fileSystem) FilePart(path string, i int) (_ *FilePart, err error) {
+	defer recoverError(&err)
+
+	f.mx.RLock()
+	h := f.fileHeader(path)
+	if h == nil || !h.IsFile() || h.Deleted() || h.FileSize() == 0 {
+		f.mx.RUnlock()
+		return nil, ErrNotFound
+	}
+	h = h.Copy()
+	partSize := f.filePartSize(h)
+	headerProof := f.rootNode().childrenMerkleProof(path)
+	f.mx.RUnlock()
+
+	hashes := mustVal(f.parts.fileParts(h.MerkleHash()))
+	if i < 0 || i >= len(hashes) {
+		return nil, ErrNotFound
+	}
+	offset := int64(i) * partSize
+	data, err := f.parts.readPart(hashes[i], min(partSize, h.FileSize()-offset))
+	if err != nil || !bytes.Equal(crypto.Hash(data), hashes[i]) {
+		return nil, &CorruptedPartError{Path: path, Part: i, Offset: offset}
+	}
+	return &FilePart{
+		Header:      h,
+		Index:       i,
+		Data:        data,
+		PartProof:   crypto.MakeMerkleProof(hashes, i),
+		HeaderProof: headerProof,
+	}, nil
+}
+
+// readPart reads the stored part of the expected size
+func (s partStore) readPart(hash []byte, size int64) ([]byte, error) {
+	r, err := s.db.OpenAt(dbTableParts, partKey(hash), 0)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, size+1))
+	if err == nil && int64(len(data)) != size {
+		err = io.ErrUnexpectedEOF
+	}
+	return data, err
+}
@@ -0,0 +1,95 @@
+package indifs
+
+import (
+	"bytes"
+	"github.com/indifs/indifs/crypto"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFileSystem_FilePart(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1", "commit2")
+	root := s.Root()
+
+	for _, h := range fsHeaders(s) {
+		if !h.IsFile() || h.Deleted() || h.FileSize() == 0 {
+			continue
+		}
+		p, err := s.FilePart(h.Path(), 0)
+		assert(t, err == nil)
+		assert(t, p.Verify(root))
+
+		content := mustVal(io.ReadAll(mustVal(s.OpenAt(h.Path(), 0))))
+		assert(t, bytes.HasPrefix(content, p.Data))
+	}
+
+	p := mustVal(s.FilePart("/A/1.txt", 0))
+
+	_, err := s.FilePart("/A/1.txt", 1)
+	assert(t, err == ErrNotFound)
+	_, err = s.FilePart("/A/", 0)
+	assert(t, err == ErrNotFound)
+
+	// modified data
+	p1 := *p
+	p1.Data = append([]byte{}, p.Data...)
+	p1.Data[0]++
+	assert(t, !p1.Verify(root))
+
+	// modified header
+	p1 = *p
+	p1.Header = p.Header.Copy()
+	p1.Header.SetInt("Size", p.Header.FileSize()+1)
+	assert(t, !p1.Verify(root))
+
+	// content replaced together with the last header field (Merkle)
+	fake := bytes.Repeat([]byte("x"), len(p.Data))
+	p1 = *p
+	p1.Header = p.Header.Copy()
+	assert(t, p1.Header[len(p1.Header)-1].Name == headerMerkleHash)
+	p1.Header.SetBytes(headerMerkleHash, crypto.MerkleRoot(crypto.Hash(fake)))
+	p1.Data, p1.PartProof = fake, crypto.MakeMerkleProof([][]byte{crypto.Hash(fake)}, 0)
+	assert(t, !p1.Verify(root))
+
+	// another index
+	p1 = *p
+	p1.Index = 1
+	assert(t, !p1.Verify(root))
+
+	// unsigned root
+	r := root.Copy()
+	r.Delete(headerSignature)
+	assert(t, !p.Verify(r))
+
+	// root signed by an unknown key
+	r = root.Copy()
+	must(r.SignAsDelegate(crypto.NewPrivateKeyFromSeed("attacker")))
+	assert(t, !p.Verify(r))
+
+	// root of another version
+	s1 := applyCommit(newTestIFS(), "commit1")
+	assert(t, !p.Verify(s1.Root()))
+}
+
+func TestFilePart_VerifyAuthority(t *testing.T) {
+	bot := testPrv.SubKey("build-bot")
+	s := applyCommit(newTestIFS(), "commit1")
+	b := mustVal(NewCommitBuilder(s))
+	must(b.Delegate(bot.PublicKey(), "/releases/"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+	prev := s.Root()
+
+	b = mustVal(NewCommitBuilder(s))
+	defer b.Close()
+	must(b.Put("/releases/app.bin", strings.NewReader("binary")))
+	must(s.Commit(mustVal(b.Build(bot))))
+
+	p := mustVal(s.FilePart("/releases/app.bin", 0))
+	assert(t, !p.Verify(s.Root())) // (signed by the delegate)
+	assert(t, p.VerifyAuthority(s.Root(), prev))
+	assert(t, !p.VerifyAuthority(s.Root(), mustVal(s.VersionInfo(1)).Root)) // the delegation is unknown
+
+	p.Data = []byte("forged")
+	assert(t, !p.VerifyAuthority(s.Root(), prev))
+}
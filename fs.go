@@ -7,25 +7,69 @@ import (
 	"github.com/indifs/indifs/crypto"
 	"github.com/indifs/indifs/database"
 	"io"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 )
 
 type fileSystem struct {
-	id    string
-	pub   crypto.PublicKey
-	db    database.Storage
-	mx    sync.RWMutex
-	nodes map[string]*fsNode
+	id                 string
+	pub                crypto.PublicKey
+	db                 database.Storage
+	parts              partStore
+	retention          *RetentionPolicy
+	equivocationPolicy func(*Equivocation) bool
+	distrusted         bool // see WithEquivocationPolicy
+	verify             bool // verify content on read
+	readOnly           bool
+	closed             bool // see Host
+	mx                 sync.RWMutex
+	nodes              map[string]*fsNode
+	versions           []Header      // root-headers of retained past versions
+	pins               map[int64]int // versions of open snapshots (see OpenVersion)
+	commitMx           sync.Mutex
+	watchMx            sync.Mutex
+	watchers           []*watcher
+	events             []*ChangeEvent // events to be delivered to watchers
+	deliverMx          sync.Mutex     // is held while events are delivered
+}
+
+// Option configures filesystem (see OpenFS)
+type Option func(f *fileSystem)
+
+// WithVerifyOnRead makes OpenAt verify every file part against its hash while reading.
+// The reader returns *CorruptedPartError at the first part that doesn't match.
+func WithVerifyOnRead() Option {
+	return func(f *fileSystem) {
+		f.verify = true
+	}
 }
 
 const dbKeyHeaders = "."
 
-func OpenFS(pub crypto.PublicKey, db database.Storage) (_ IFS, err error) {
+func OpenFS(pub crypto.PublicKey, db database.Storage, opts ...Option) (IFS, error) {
+	f, err := openFS(pub, db, opts)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func fsTableID(pub crypto.PublicKey) string {
+	return fmt.Sprintf("ifs%X", pub[:16])
+}
+
+func openFS(pub crypto.PublicKey, db database.Storage, opts []Option) (_ *fileSystem, err error) {
 	defer recoverError(&err)
 	s := &fileSystem{
-		id:  fmt.Sprintf("ifs%X", pub[:16]),
-		pub: pub,
-		db:  db,
+		id:    fsTableID(pub),
+		pub:   pub,
+		db:    db,
+		parts: partStore{db},
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	s.initDB()
 	return s, nil
@@ -55,6 +99,28 @@ func (f *fileSystem) initDB() {
 		hh = []Header{NewRootHeader(f.pub)}
 	}
 	f.nodes = mustVal(indexTree(hh))
+	require(isSupportedProtocol(f.rootNode().Header.Protocol()), ErrUnsupportedProtocol)
+	f.dbGetJSON(dbKeyVersions, &f.versions)
+	if f.retention == nil {
+		f.dbGetJSON(dbKeyRetention, &f.retention)
+	}
+	f.dbGetJSON(dbKeyDistrusted, &f.distrusted)
+	must(f.reconcileParts())
+}
+
+// reconcileParts finishes reference changes of the last update of the filesystem table (see pendingRefs).
+// The update is done if the stored root-header is the new one
+// (or if the table is empty for the dropped filesystem).
+func (f *fileSystem) reconcileParts() error {
+	p, err := f.parts.pending(f.id)
+	if p == nil || err != nil {
+		return err
+	}
+	r := f.Root()
+	done := p.Root == nil && r.Ver() == 0 || p.Root != nil && bytes.Equal(p.Root, r.Hash())
+	return f.parts.execute(func(tx *partsTx) {
+		tx.finishPending(f.id, p, done)
+	})
 }
 
 func (f *fileSystem) dbGetJSON(path string, v any) {
@@ -65,6 +131,30 @@ func (f *fileSystem) dbGetJSON(path string, v any) {
 	}
 }
 
+// keyVersions returns versions from the keys with the prefix not greater than maxVer in descending order.
+// If the storage can't list keys, all versions up to maxVer are returned.
+func (f *fileSystem) keyVersions(prefix string, maxVer int64) (vers []int64) {
+	keys, err := database.Keys(f.db, f.id, prefix)
+	if err == database.ErrNotSupported {
+		for ver := maxVer; ver > 0; ver-- {
+			vers = append(vers, ver)
+		}
+		return
+	}
+	for _, key := range mustVal(keys, err) {
+		if ver, err := strconv.ParseInt(strings.TrimPrefix(key, prefix), 10, 64); err == nil && ver <= maxVer {
+			vers = append(vers, ver)
+		}
+	}
+	sort.Slice(vers, func(i, j int) bool { return vers[i] > vers[j] })
+	return
+}
+
+func putJSON(tx database.Transaction, key string, v any) {
+	data := mustVal(json.Marshal(v))
+	must(tx.Put(key, int64(len(data)), bytes.NewReader(data)))
+}
+
 func (f *fileSystem) fileHeader(path string) Header {
 	if nd := f.nodes[path]; nd != nil {
 		return nd.Header
@@ -106,33 +196,43 @@ func (f *fileSystem) rootPartSize() int64 {
 	return DefaultFilePartSize
 }
 
-func (f *fileSystem) FileParts(path string) (hashes [][]byte, err error) {
+func (f *fileSystem) filePartSize(h Header) int64 {
+	if h.Has(headerFilePartSize) {
+		return h.PartSize()
+	}
+	return f.rootPartSize()
+}
+
+// fileContent returns header of the file with content
+func (f *fileSystem) fileContent(path string) (h Header, err error) {
 	f.mx.RLock()
 	defer f.mx.RUnlock()
 
-	h := f.fileHeader(path)
-	if h == nil {
+	if h = f.fileHeader(path); h == nil || !h.IsFile() || h.Deleted() {
 		return nil, ErrNotFound
 	}
-	fl, err := f.db.OpenAt(f.id, path, 0)
-	if err != nil {
-		return
-	}
-	defer fl.Close()
+	return
+}
 
-	partSize := h.PartSize()
-	if partSize == 0 {
-		partSize = f.rootPartSize()
-	}
-	w := crypto.NewMerkleHash(partSize)
-	if _, err = io.Copy(w, fl); err != nil {
+func (f *fileSystem) FileParts(path string) (hashes [][]byte, err error) {
+	h, err := f.fileContent(path)
+	if err != nil || h.FileSize() == 0 {
 		return
 	}
-	return w.Leaves(), nil
+	return f.parts.fileParts(h.MerkleHash())
 }
 
 func (f *fileSystem) OpenAt(path string, offset int64) (io.ReadCloser, error) {
-	return f.db.OpenAt(f.id, path, offset)
+	h, err := f.fileContent(path)
+	if err != nil {
+		return nil, err
+	}
+	if size := h.FileSize(); offset > size {
+		return nil, ErrNotFound
+	} else if size == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return f.parts.open(path, h.MerkleHash(), h.FileSize(), f.filePartSize(h), offset, f.verify)
 }
 
 func (f *fileSystem) ReadDir(path string) ([]Header, error) {
@@ -156,8 +256,14 @@ func (f *fileSystem) GetCommit(ver int64) (commit *Commit, err error) {
 	}
 	w := newMultiReader()
 	commit = &Commit{Body: w}
+	if v := f.versionInfo(root.Header.Ver()); v != nil {
+		commit.Info = v.Info
+	}
 	root.walk(func(nd *fsNode) bool {
-		if h := nd.Header; h.Ver() > ver {
+		// (a directory of a later version replaces all its content, so its children are added too)
+		parent := f.nodes[dirname(nd.path)]
+		isDirUp := !nd.isRoot() && !parent.isRoot() && parent.Header.Ver() > ver
+		if h := nd.Header; h.Ver() > ver || isDirUp {
 			commit.Headers = append(commit.Headers, h.Copy())
 
 			// TODO: rr[] = f.getReader(path) ...;  commit.Body = io.MultiReader(rr...)
@@ -172,12 +278,66 @@ func (f *fileSystem) GetCommit(ver int64) (commit *Commit, err error) {
 	return
 }
 
-func (f *fileSystem) Commit(commit *Commit) (err error) {
+// mergeHeaders returns sorted headers of the tree updated by the commit headers
+func mergeHeaders(tree map[string]*fsNode, commitHH []Header) []Header {
+	updated := make(map[string]Header, len(commitHH))
+	for _, h := range commitHH {
+		updated[h.Path()] = h
+	}
+	hh := make([]Header, 0, len(commitHH)+len(tree))
+	hh = append(hh, commitHH...)
+
+	var treeWalk func(nd *fsNode)
+	treeWalk = func(nd *fsNode) {
+		if nd == nil {
+			return
+		}
+		h := updated[nd.path]
+		if h == nil {
+			hh = append(hh, nd.Header)
+		}
+		if h == nil || !h.Deleted() { // add existed children to new tree
+
+			// exclude branches if directory version was changed
+			isDirUp := h != nil && nd.isDir() && !nd.isRoot() && h.Ver() > nd.Header.Ver()
+
+			for _, ch := range nd.children {
+				if !isDirUp || updated[ch.path] != nil {
+					treeWalk(ch)
+				}
+			}
+		}
+	}
+	treeWalk(tree[""])
+	sortHeaders(hh)
+	return hh
+}
+
+// Commit applies the commit.
+// If the commit is applied but the content of old files can't be released,
+// the error is returned too; the release is retried by the next commit or when the filesystem is opened.
+func (f *fileSystem) Commit(commit *Commit) error {
+	f.commitMx.Lock()
+	e, err := f.commit(commit)
+	if e != nil {
+		f.enqueue(e) // (events are queued in the order of commits)
+	}
+	f.commitMx.Unlock()
+
+	f.deliver()
+	return err
+}
+
+// commit applies the commit; returns the event if the commit is applied
+func (f *fileSystem) commit(commit *Commit) (e *ChangeEvent, err error) {
 	defer recoverError(&err)
 	f.mx.Lock()
 	defer f.mx.Unlock()
 
 	//--- verify commit ---
+	require(!f.readOnly, errReadOnly)
+	require(!f.closed, ErrClosed)
+	require(!f.distrusted, ErrUntrustedKey)
 	require(len(commit.Headers) > 0, "empty commit")
 	sortHeaders(commit.Headers)
 
@@ -185,8 +345,8 @@ func (f *fileSystem) Commit(commit *Commit) (err error) {
 	r := f.Root()
 	c := commit.Root() // commit.Headers[0]
 
-	require(protocolVerMajor(c.Get(headerProtocol)) == protocolVerMajor(DefaultProtocol), "unsupported Protocol version")
-	require(protocolVer64(c.Get(headerProtocol)) >= protocolVer64(r.Get(headerProtocol)), "unsupported Protocol version")
+	require(isSupportedProtocol(c.Protocol()), ErrUnsupportedProtocol)
+	require(protocolVer64(c.Protocol()) >= protocolVer64(r.Protocol()), ErrUnsupportedProtocol)
 	require(ValidateHeader(c) == nil, "invalid commit root-header")
 	require(c.IsRoot(), "invalid commit root-header")
 	require(c.Ver() > 0, "invalid commit root-header Ver")
@@ -195,31 +355,29 @@ func (f *fileSystem) Commit(commit *Commit) (err error) {
 	require(!c.Updated().IsZero(), "invalid commit-header Updated")
 	require(c.Created().Equal(r.Created()) || r.Created().IsZero(), "invalid commit-header Created")
 	require(!c.Updated().Before(c.Created()), "invalid commit-header Updated")
-	require(VersionIsGreater(c, r), "invalid commit-header Ver")
 	require(!c.Deleted(), "invalid commit-header Deleted")
 	require(c.PublicKey().Equal(f.pub), "invalid commit-header Public-Key")
-	require(c.Verify(), "invalid commit-header Signature")
+	require(c.verifySignature(c.signerKey()), "invalid commit-header Signature")
+	f.checkEquivocation(c)
+	require(VersionIsGreater(c, r), "invalid commit-header Ver")
+	verifyKeyRotation(r, c)
+	require(c.VerifyAuthority(r), ErrNotAuthorized)
+	isDelegated := !c.Verify()
+	if isDelegated { // signed by a delegate (a delegate can`t replace the current version)
+		require(c.Ver() > r.Ver() && c.Ver()-r.Ver() <= maxDelegateVerStep, ErrNotAuthorized)
+	}
+	info := f.verifyCommitInfo(c, commit.Info)
 
 	//-----------
 	curTree := f.nodes
-	delFiles := map[string]bool{} // files to delete
-	if c.Ver() == r.Ver() {       // if versions are equal than truncate db
+	if c.Ver() == r.Ver() { // if versions are equal than truncate db
 		curTree = map[string]*fsNode{}
-		for _, nd := range f.nodes {
-			if !nd.isDir() && nd.Header.FileSize() > 0 {
-				delFiles[nd.path] = true
-			}
-		}
 	}
 
 	//--- verify other headers ---
-	updated := make(map[string]Header, len(commit.Headers))
-	hh := make([]Header, 0, len(commit.Headers)+len(curTree))
 	for _, h := range commit.Headers {
 		must(ValidateHeader(h))
 		path := h.Path()
-		hh = append(hh, h)
-		updated[path] = h
 
 		// verify commit-content
 		hasMerkle := h.Has(headerMerkleHash)
@@ -236,46 +394,19 @@ func (f *fileSystem) Commit(commit *Commit) (err error) {
 			isZeroLenFile := h.FileSize() == 0 // or is deleted
 			require(isZeroLenFile != hasMerkle, "invalid commit-header")
 		}
-		if h.Deleted() { // delete all sub-files
+		if h.Deleted() {
 			require(h.FileSize() == 0, "invalid commit-header")
-			curTree[path].walk(func(nd *fsNode) bool {
-				if !nd.isDir() && nd.Header.FileSize() > 0 {
-					delFiles[nd.path] = true
-				}
-				return true
-			})
-		} else { // can`t restore deleted node
+		} else { // deleted node can be restored only by a later version
 			nd := curTree[path]
-			require(nd == nil || !nd.Header.Deleted(), "invalid commit-header")
+			require(nd == nil || !nd.Header.Deleted() || h.Ver() > nd.Header.Ver(), "invalid commit-header")
 		}
 	}
-	//--- merge with existed headers ---
-	var treeWalk func(nd *fsNode)
-	treeWalk = func(nd *fsNode) {
-		if nd == nil {
-			return
-		}
-		h := updated[nd.path]
-		if h == nil {
-			hh = append(hh, nd.Header)
-		}
-		if h == nil || !h.Deleted() { // add existed children to new tree
-
-			// exclude branches if directory version was changed
-			isDirUp := h != nil && nd.isDir() && !nd.isRoot() && h.Ver() > nd.Header.Ver()
-
-			for _, ch := range nd.children {
-				if !isDirUp || updated[ch.path] != nil {
-					treeWalk(ch)
-				}
-			}
-		}
-	}
-	treeWalk(curTree[""])
-
-	//--- update tree
-	sortHeaders(hh)
+	//--- merge with existed headers; update tree
+	hh := mergeHeaders(curTree, commit.Headers)
 	newTree := mustVal(indexTree(hh))
+	if isDelegated {
+		f.verifyDelegatedCommit(r, c, newTree)
+	}
 
 	//--- verify new root merkle and total-volume (Merkle-Root and Volume headers)
 	newRoot := newTree[""]
@@ -297,9 +428,24 @@ func (f *fileSystem) Commit(commit *Commit) (err error) {
 		return true
 	})
 
+	//--- count references to file contents (new tree minus released trees)
+	versions, retainCur, pruned := f.nextVersions(c)
+	refs := fileRefs(newTree)
+	if !retainCur {
+		for merkle, n := range fileRefs(f.nodes) {
+			refs[merkle] -= n
+		}
+	}
+	for _, v := range pruned {
+		for merkle, n := range fileRefs(f.versionTree(v.Ver())) {
+			refs[merkle] -= n
+		}
+	}
+
 	//--- verify and put file content
-	must(f.db.Execute(f.id, func(tx database.Transaction) (err error) {
-		defer recoverError(&err)
+	// (the reference changes are saved as pending until the filesystem table is updated)
+	must(f.reconcileParts())
+	must(f.parts.execute(func(tx *partsTx) {
 		for _, h := range commit.Headers {
 			if !h.IsFile() {
 				continue
@@ -309,27 +455,51 @@ func (f *fileSystem) Commit(commit *Commit) (err error) {
 				if h.Has(headerFilePartSize) {
 					partSize = h.PartSize()
 				}
-				// require(partSize > 0, "empty commit-header Part-Size")
-
-				r := io.LimitReader(commit.Body, hSize)
-				w := crypto.NewMerkleHash(partSize)
-				must(tx.Put(h.Path(), hSize, io.TeeReader(r, w)))
-				require(w.Written() == hSize, "invalid commit-content")
-				require(bytes.Equal(w.Root(), h.MerkleHash()), "invalid commit-header Merkle")
-				delete(delFiles, h.Path())
+				tx.putFile(commit.Body, hSize, partSize, hMerkle)
+			}
+		}
+		for merkle, n := range refs {
+			if n > 0 {
+				tx.addFileRefs([]byte(merkle), n)
 			}
 		}
+		tx.putPending(f.id, newPendingRefs(c.Hash(), refs))
+	}))
+
+	changed := 0 // (unchanged children of updated directories are not counted)
+	for _, h := range commit.Headers[1:] {
+		if nd := curTree[h.Path()]; nd == nil || !bytes.Equal(nd.Header.Hash(), h.Hash()) {
+			changed++
+		}
+	}
 
-		//--- delete old files (???) -----
-		for path := range delFiles {
-			must(tx.Delete(path))
+	//--- save to Storage
+	err = f.db.Execute(f.id, func(tx database.Transaction) (err error) {
+		defer recoverError(&err)
+		putJSON(tx, dbKeyHeaders, hh)
+		putJSON(tx, historyKey(c.Ver()), VersionInfo{c, info, changed})
+		if retainCur {
+			putJSON(tx, versionKey(r.Ver()), f.headers())
+		}
+		for _, v := range pruned {
+			must(tx.Delete(versionKey(v.Ver())))
+		}
+		putJSON(tx, dbKeyVersions, versions)
+		if f.retention != nil {
+			putJSON(tx, dbKeyRetention, f.retention)
 		}
-		//--- save to Storage
-		data := mustVal(json.Marshal(hh))
-		must(tx.Put(dbKeyHeaders, int64(len(data)), bytes.NewReader(data)))
 		return
-	}))
+	})
+	if err != nil {
+		f.reconcileParts() // remove the added references
+		return nil, err
+	}
+
+	e = newChangeEvent(f.nodes, newTree)
+	f.nodes, f.versions = newTree, versions
 
-	f.nodes = newTree
+	//--- delete old files
+	// (on failure the pending references are released by the next commit or when the filesystem is opened)
+	err = f.reconcileParts()
 	return
 }
@@ -0,0 +1,129 @@
+package indifs
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy defines which past versions of a filesystem are kept in the storage.
+// A version is kept while it satisfies all the limits.
+type RetentionPolicy struct {
+	MaxVersions int           // max number of kept past versions (0 – unlimited, -1 – none)
+	MaxAge      time.Duration // max age of kept past versions, counted from the latest version (0 – unlimited)
+}
+
+const (
+	dbKeyVersions      = ".versions"  // root-headers of retained past versions
+	dbKeyVersionPrefix = ".v/"        // headers of a retained past version
+	dbKeyRetention     = ".retention" // retention policy (see WithRetention)
+)
+
+var errReadOnly = errors.New("read-only filesystem")
+
+// snapshot is a read-only filesystem of a version (see OpenVersion).
+// The version is not pruned while the snapshot is open.
+type snapshot struct {
+	*fileSystem
+	origin *fileSystem
+	once   sync.Once
+}
+
+// WithRetention enables keeping of past versions of the filesystem (see IFS.OpenVersion).
+// The policy is saved with the next commit and used when the filesystem is opened without the option.
+func WithRetention(p RetentionPolicy) Option {
+	return func(f *fileSystem) {
+		f.retention = &p
+	}
+}
+
+func (p *RetentionPolicy) keeps(n int, age time.Duration) bool {
+	return p != nil &&
+		(p.MaxVersions == 0 || n <= p.MaxVersions) &&
+		(p.MaxAge == 0 || age <= p.MaxAge)
+}
+
+func versionKey(ver int64) string {
+	return dbKeyVersionPrefix + strconv.FormatInt(ver, 10)
+}
+
+// nextVersions returns the list of past versions after applying the commit with the root-header c.
+// retainCur says the current version has to be saved as a past version.
+func (f *fileSystem) nextVersions(c Header) (versions []Header, retainCur bool, pruned []Header) {
+	cur := f.Root()
+	candidates := append([]Header{}, f.versions...)
+	if c.Ver() > cur.Ver() && cur.Ver() > 0 {
+		candidates = append(candidates, cur)
+	}
+	for i, h := range candidates {
+		isCur := h.Ver() == cur.Ver()
+		if f.retention.keeps(len(candidates)-i, c.Updated().Sub(h.Updated())) || f.pins[h.Ver()] > 0 {
+			versions = append(versions, h)
+			retainCur = retainCur || isCur
+		} else if !isCur {
+			pruned = append(pruned, h)
+		}
+	}
+	return
+}
+
+func (f *fileSystem) versionTree(ver int64) map[string]*fsNode {
+	if ver == f.Root().Ver() {
+		return f.nodes
+	}
+	for _, h := range f.versions {
+		if h.Ver() == ver {
+			var hh []Header
+			f.dbGetJSON(versionKey(ver), &hh)
+			require(len(hh) > 0, "version headers not found")
+			return mustVal(indexTree(hh))
+		}
+	}
+	return nil
+}
+
+func (f *fileSystem) OpenVersion(ver int64) (_ IFS, err error) {
+	defer recoverError(&err)
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	tree := f.versionTree(ver)
+	if tree == nil {
+		return nil, ErrNotFound
+	}
+	if f.pins == nil {
+		f.pins = map[int64]int{}
+	}
+	f.pins[ver]++
+	return &snapshot{
+		fileSystem: &fileSystem{
+			id:       f.id,
+			pub:      f.pub,
+			db:       f.db,
+			parts:    f.parts,
+			verify:   f.verify,
+			readOnly: true,
+			nodes:    tree,
+			versions: f.versions,
+		},
+		origin: f,
+	}, nil
+}
+
+func (s *snapshot) OpenVersion(ver int64) (IFS, error) {
+	return s.origin.OpenVersion(ver)
+}
+
+// Close releases the version; it is pruned by a next commit if the retention policy doesn't keep it
+func (s *snapshot) Close() error {
+	s.once.Do(func() {
+		f := s.origin
+		f.mx.Lock()
+		defer f.mx.Unlock()
+		if f.pins[s.Root().Ver()]--; f.pins[s.Root().Ver()] <= 0 {
+			delete(f.pins, s.Root().Ver())
+		}
+	})
+	return nil
+}
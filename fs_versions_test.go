@@ -0,0 +1,97 @@
+package indifs
+
+import (
+	"github.com/indifs/indifs/database/memdb"
+	"io"
+	"testing"
+)
+
+func TestFileSystem_OpenVersion(t *testing.T) {
+	db := memdb.New()
+	s := mustVal(OpenFS(testPub, db, WithRetention(RetentionPolicy{MaxVersions: 1})))
+	applyCommit(s, "commit1")
+	readme1 := mustVal(s.FileHeader("/readme.txt"))
+
+	applyCommit(s, "commit2", "commit3")
+	assert(t, s.Root().Ver() == 3)
+
+	//--- version 2 is retained
+	s2, err := s.OpenVersion(2)
+	assert(t, err == nil)
+	assert(t, s2.Root().Ver() == 2)
+
+	a, err := s2.FileHeader("/B/2/a.txt") // deleted in version 3
+	assert(t, err == nil)
+	r, err := s2.OpenAt("/B/2/a.txt", 0)
+	assert(t, err == nil)
+	data, err := io.ReadAll(r)
+	assert(t, err == nil)
+	assert(t, int64(len(data)) == a.FileSize())
+
+	proof, err := s2.FileMerkleProof("/B/2/a.txt")
+	assert(t, err == nil)
+	assert(t, s2.Root().Verify())
+	assert(t, a.VerifyMerkleProof(s2.Root().MerkleHash(), proof))
+
+	// snapshot is read-only
+	err = s2.Commit(makeTestCommit(s2, "commit1"))
+	assert(t, err != nil)
+
+	//--- version 1 is pruned
+	_, err = s.OpenVersion(1)
+	assert(t, err == ErrNotFound)
+	assert(t, testFileRefs(db, readme1.MerkleHash()) == 0)
+
+	//--- current version
+	s3, err := s.OpenVersion(3)
+	assert(t, err == nil)
+	assert(t, equal(fsHeaders(s3), fsHeaders(s)))
+
+	//--- reopen filesystem
+	s = mustVal(OpenFS(testPub, db, WithRetention(RetentionPolicy{MaxVersions: 1})))
+	_, err = s.OpenVersion(2)
+	assert(t, err == nil)
+}
+
+func TestFileSystem_OpenVersion_noRetention(t *testing.T) {
+	db := memdb.New()
+	s := applyCommit(mustVal(OpenFS(testPub, db)), "commit1", "commit2")
+
+	_, err := s.OpenVersion(1)
+	assert(t, err == ErrNotFound)
+
+	_, err = s.OpenVersion(2)
+	assert(t, err == nil)
+}
+
+func TestFileSystem_OpenVersion_savedRetention(t *testing.T) {
+	db := memdb.New()
+	s := mustVal(OpenFS(testPub, db, WithRetention(RetentionPolicy{MaxVersions: 2})))
+	applyCommit(s, "commit1", "commit2")
+
+	// the filesystem opened without the option keeps the saved policy
+	s = applyCommit(mustVal(OpenFS(testPub, db)), "commit3")
+	_, err := s.OpenVersion(1)
+	assert(t, err == nil)
+	_, err = s.OpenVersion(2)
+	assert(t, err == nil)
+}
+
+func TestFileSystem_OpenVersion_snapshotIsKept(t *testing.T) {
+	db := memdb.New()
+	s := applyCommit(mustVal(OpenFS(testPub, db)), "commit1")
+	readme1 := mustVal(s.FileHeader("/readme.txt"))
+
+	s1 := mustVal(s.OpenVersion(1))
+	applyCommit(s, "commit2") // changes readme.txt
+
+	// content of the open snapshot is not released
+	assert(t, testFileRefs(db, readme1.MerkleHash()) == 1)
+	assert(t, len(testReadFile(s1, "/readme.txt")) == int(readme1.FileSize()))
+
+	must(s1.(io.Closer).Close())
+	applyCommit(s, "commit3")
+	assert(t, testFileRefs(db, readme1.MerkleHash()) == 0)
+	_, err := s.OpenVersion(1)
+	assert(t, err == ErrNotFound)
+}
@@ -0,0 +1,129 @@
+package indifs
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/indifs/indifs/database"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// HashCache keeps Merkle-roots of source files between calls of MakeCommit (see WithHashCache),
+// so unchanged files are not read and hashed again.
+//
+// A cached value is used only if size, modification time and inode (if available) of the file
+// are not changed. Files of fs.FS without modification times are always hashed.
+// One cache has to be used for one source tree.
+type HashCache struct {
+	db    database.Storage
+	table string
+}
+
+type hashCacheEntry struct {
+	Size     int64  `json:"size"`
+	ModTime  int64  `json:"mtime"` // unix nano
+	Inode    uint64 `json:"inode,omitempty"`
+	PartSize int64  `json:"psize"`
+	Merkle   []byte `json:"merkle"`
+}
+
+// hashCacheRacyTime – files modified later than this time before hashing are not cached
+// (they can be changed again without changing of modification time)
+const hashCacheRacyTime = 2 * time.Second
+
+// NewHashCache returns the cache stored in the table of the storage
+func NewHashCache(db database.Storage, table string) *HashCache {
+	return &HashCache{db: db, table: table}
+}
+
+// WithHashCache makes MakeCommit use the cache of file hashes
+func WithHashCache(c *HashCache) CommitOption {
+	return func(cfg *commitConfig) {
+		cfg.cache = c
+	}
+}
+
+// hashCacheTx collects cache changes made by one MakeCommit call
+type hashCacheTx struct {
+	c       *HashCache
+	started time.Time
+	entries map[string]*hashCacheEntry // new entries
+	visited map[string]bool
+}
+
+func (c *HashCache) begin() *hashCacheTx {
+	if c == nil {
+		return nil
+	}
+	return &hashCacheTx{
+		c:       c,
+		started: time.Now(),
+		entries: map[string]*hashCacheEntry{},
+		visited: map[string]bool{},
+	}
+}
+
+func (c *HashCache) get(path string) (e *hashCacheEntry) {
+	r, err := c.db.OpenAt(c.table, path, 0)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	if data, err := io.ReadAll(r); err != nil || json.Unmarshal(data, &e) != nil {
+		return nil
+	}
+	return
+}
+
+// fileMerkle returns size and Merkle-root of the source file
+func (t *hashCacheTx) fileMerkle(src fs.FS, path string, partSize int64) (size int64, merkle []byte) {
+	if t == nil {
+		size, merkle, _ = fsMerkleRoot(src, path, partSize)
+		return
+	}
+	t.visited[path] = true
+	fi, err := fs.Stat(src, path)
+	if err != nil || fi.ModTime().IsZero() { // no stat info
+		size, merkle, _ = fsMerkleRoot(src, path, partSize)
+		return
+	}
+	inode, _ := fileInode(fi)
+	e := &hashCacheEntry{
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime().UnixNano(),
+		Inode:    inode,
+		PartSize: partSize,
+	}
+	if c := t.c.get(path); c != nil && c.Size == e.Size && c.ModTime == e.ModTime && c.Inode == e.Inode && c.PartSize == e.PartSize {
+		return c.Size, c.Merkle
+	}
+	size, merkle, _ = fsMerkleRoot(src, path, partSize)
+	if size == e.Size && fi.ModTime().Before(t.started.Add(-hashCacheRacyTime)) {
+		e.Merkle = merkle
+		t.entries[path] = e
+	}
+	return
+}
+
+// flush saves new entries and deletes entries of files not found in the source.
+// Errors are ignored: the cache is used only to speed up hashing.
+func (t *hashCacheTx) flush() {
+	if t == nil {
+		return
+	}
+	keys, _ := database.Keys(t.c.db, t.c.table, "") // (entries of deleted files are kept if keys can't be listed)
+	t.c.db.Execute(t.c.table, func(tx database.Transaction) (err error) {
+		defer recoverError(&err)
+		for path, e := range t.entries {
+			data := mustVal(json.Marshal(e))
+			must(tx.Put(path, int64(len(data)), bytes.NewReader(data)))
+		}
+		for _, path := range keys {
+			if !t.visited[path] {
+				must(tx.Delete(path))
+			}
+		}
+		return
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package indifs
+
+import "io/fs"
+
+func fileInode(fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
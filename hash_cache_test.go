@@ -0,0 +1,78 @@
+package indifs
+
+import (
+	"github.com/indifs/indifs/database/memdb"
+	"github.com/indifs/indifs/test_data"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countingFS counts opened files
+type countingFS struct {
+	fs.FS
+	opened int
+}
+
+func (f *countingFS) Open(name string) (fs.File, error) {
+	f.opened++
+	return f.FS.Open(name)
+}
+
+func (f *countingFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.FS, name)
+}
+
+func (f *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.FS, name)
+}
+
+func TestMakeCommit_withHashCache(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Now().Add(-time.Hour)
+	must(fs.WalkDir(test_data.FS("commit1"), ".", func(path string, d fs.DirEntry, err error) error {
+		must(err)
+		name := filepath.Join(dir, path)
+		if d.IsDir() {
+			must(os.MkdirAll(name, 0755))
+		} else {
+			must(os.WriteFile(name, mustVal(fs.ReadFile(test_data.FS("commit1"), path)), 0644))
+		}
+		return os.Chtimes(name, mtime, mtime)
+	}))
+	src := &countingFS{FS: os.DirFS(dir)}
+	cache := NewHashCache(memdb.New(), "cache")
+	s := newTestIFS()
+
+	// all files are hashed
+	commit := mustVal(MakeCommit(s, testPrv, src, testCommitTime, WithHashCache(cache)))
+	assert(t, src.opened == 9)
+	must(s.Commit(commit))
+
+	// unchanged files are not hashed
+	src.opened = 0
+	commit = mustVal(MakeCommit(s, testPrv, src, time.Time{}, WithHashCache(cache)))
+	assert(t, src.opened == 0)
+	assert(t, len(commit.Headers) == 1)
+
+	// changed file is hashed
+	must(os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("changed"), 0644))
+	must(os.Chtimes(filepath.Join(dir, "readme.txt"), mtime, mtime.Add(time.Second)))
+	src.opened = 0
+	commit = mustVal(MakeCommit(s, testPrv, src, time.Time{}, WithHashCache(cache)))
+	assert(t, src.opened == 1)
+	assert(t, len(commit.Headers) == 2 && commit.Headers[1].Path() == "/readme.txt")
+	must(s.Commit(commit))
+	assert(t, testReadFile(s, "/readme.txt") == "changed")
+
+	// without the cache (and for fs.FS without modification times) all files are hashed
+	src.opened = 0
+	mustVal(MakeCommit(s, testPrv, src, time.Time{}))
+	assert(t, src.opened == 9)
+
+	src = &countingFS{FS: test_data.FS("commit1")}
+	mustVal(MakeCommit(newTestIFS(), testPrv, src, time.Time{}, WithHashCache(cache)))
+	assert(t, src.opened == 9)
+}
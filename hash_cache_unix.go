@@ -0,0 +1,15 @@
+//go:build unix
+
+package indifs
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func fileInode(fi fs.FileInfo) (uint64, bool) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino), true
+	}
+	return 0, false
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/indifs/indifs/crypto"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -43,6 +44,9 @@ const (
 	headerPublicKey = "Public-Key" //
 	headerSignature = "Signature"  //
 	headerVolume    = "Volume"     // volume of full file tree
+	headerSigner    = "Signer"     // public key of the delegate signed the root-header (see Delegation)
+	headerDelegate  = "Delegate"   // delegation of the root-header (see Delegation)
+	headerSuccessor = "Successor"  // successor of the owner key (see KeyRotation)
 
 	// general
 	headerVer        = "Ver"     // File or directory version
@@ -271,14 +275,14 @@ func (h *Header) Delete(key string) {
 	}
 }
 
-// Hash returns the hash of the header.
+// Hash returns the hash of the header: all fields are hashed except the last field "Signature".
 func (h Header) Hash() []byte {
 	n := len(h)
 	if n > 0 && h[n-1].Name == headerSignature { // exclude last header "Signature"
 		n--
 	}
 	hsh := crypto.NewHash()
-	for _, kv := range h[:n-1] {
+	for _, kv := range h[:n] {
 		// write <len><Name>
 		binary.Write(hsh, binary.BigEndian, uint32(len(kv.Name)))
 		hsh.Write([]byte(kv.Name))
@@ -388,20 +392,72 @@ func (h *Header) SetPublicKey(pub crypto.PublicKey) {
 	h.Set(headerPublicKey, pub.Encode())
 }
 
-// Sign signs the header with the given private key.
-func (h *Header) Sign(prv crypto.PrivateKey) {
-	h.SetPublicKey(prv.PublicKey())
+// Sign signs the header with the given signer (e.g. a private key).
+func (h *Header) Sign(signer crypto.Signer) error {
+	h.SetPublicKey(signer.PublicKey())
 
+	h.Delete(headerSigner)
+	return h.addSignature(signer)
+}
+
+// SignAsDelegate signs the root-header with the key of a delegate or a successor (see KeyRotation);
+// Public-Key of the filesystem is not changed.
+func (h *Header) SignAsDelegate(signer crypto.Signer) error {
+	h.Set(headerSigner, signer.PublicKey().Encode())
+	return h.addSignature(signer)
+}
+
+func (h *Header) addSignature(signer crypto.Signer) error {
 	h.Delete(headerSignature)
-	h.AddBytes(headerSignature, prv.Sign(h.Hash()))
+	sig, err := signer.SignDigest(h.Hash())
+	if err == nil {
+		h.AddBytes(headerSignature, sig)
+	}
+	return err
 }
 
-// Verify verifies the signature of the root-header.
+// Signer returns the public key of the delegate or the successor signed the root-header (nil if the header is signed by Public-Key).
+func (h Header) Signer() crypto.PublicKey {
+	if !h.Has(headerSigner) {
+		return nil
+	}
+	return crypto.DecodePublicKey(h.Get(headerSigner))
+}
+
+// signerKey returns the public key the root-header is signed with
+func (h Header) signerKey() crypto.PublicKey {
+	if h.Has(headerSigner) {
+		return h.Signer()
+	}
+	return h.PublicKey()
+}
+
+// Verify says the root-header is signed by its owner (see Owner).
+// A root-header signed by a delegate is verified by VerifyAuthority.
 func (h Header) Verify() bool {
+	owner := h.Owner()
+	return owner != nil && owner.Equal(h.signerKey()) && h.verifySignature(owner)
+}
+
+// VerifyAuthority says the root-header is signed by its owner or by a delegate of the access list
+// of the previous root-header prev, and its chain of key rotations continues the chain of prev.
+func (h Header) VerifyAuthority(prev Header) bool {
+	signer := h.signerKey()
+	if !h.verifySignature(signer) || prev.Ver() > 0 && !prev.PublicKey().Equal(h.PublicKey()) ||
+		keyRotationError(prev, h) != nil {
+		return false
+	}
+	return signer.Equal(h.Owner()) || slices.ContainsFunc(prev.Delegations(), func(d Delegation) bool {
+		return d.PublicKey.Equal(signer)
+	})
+}
+
+// verifySignature says the header is signed with the public key
+func (h Header) verifySignature(pub crypto.PublicKey) bool {
 	n := len(h)
-	return n >= 2 &&
+	return n >= 2 && pub != nil &&
 		h[n-1].Name == headerSignature && // last key is "Signature"
-		h.PublicKey().Verify(h[:n-1].Hash(), h[n-1].Value)
+		pub.Verify(h[:n-1].Hash(), h[n-1].Value)
 }
 
 // VerifyMerkleProof verifies the merkle-proof of the header.
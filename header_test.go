@@ -3,7 +3,10 @@ package indifs
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"github.com/indifs/indifs/crypto"
+	"github.com/indifs/indifs/database/memdb"
+	"github.com/indifs/indifs/test_data"
 	"testing"
 )
 
@@ -33,7 +36,7 @@ var (
 )
 
 func init() {
-	testHeaders[0].Sign(testPrv)
+	must(testHeaders[0].Sign(testPrv))
 }
 
 const testHeadersJSON = `[{
@@ -44,7 +47,7 @@ const testHeadersJSON = `[{
 	"Updated":"2022-01-01T01:02:03Z",
 	"Part-Size":"1024",
 	"Public-Key":"Ed25519,pms+pTAx/wOs+rx9Gy4wbdMWR/iz6MkEUBGlPF121GU=",
-	"Signature":"b64,Q4YmNXtV2avPrCl5r9cJfW1HVZWUQq781te2sdCgbdlW1ticCFMSwJeuEvGqpiZm7Xj6xq6Px0E7+V448HjBBA"
+	"Signature":"b64,6fJFQhwNQzteq97/5h9mof2KSvNjHtageeZQ1abWofdvAs+fhDiKg/3FA+69Sj0wQGsOMgcEA+MTJf7sfUOVAA"
 },{
 	"Ver":"1",
 	"Path":"/"
@@ -101,7 +104,7 @@ func TestHeader_String(t *testing.T) {
 		"Updated":     "2022-01-01T01:02:03Z",
 		"Part-Size":   "1024",
 		"Public-Key":  "Ed25519,pms+pTAx/wOs+rx9Gy4wbdMWR/iz6MkEUBGlPF121GU=",
-		"Signature":   "b64,Q4YmNXtV2avPrCl5r9cJfW1HVZWUQq781te2sdCgbdlW1ticCFMSwJeuEvGqpiZm7Xj6xq6Px0E7+V448HjBBA"
+		"Signature":   "b64,6fJFQhwNQzteq97/5h9mof2KSvNjHtageeZQ1abWofdvAs+fhDiKg/3FA+69Sj0wQGsOMgcEA+MTJf7sfUOVAA"
 	}`))
 }
 
@@ -123,10 +126,77 @@ func TestHeader_Hash(t *testing.T) {
 	h0 := testHeaders[0]
 	hash := hex.EncodeToString(h0[:len(h0)-1].Hash())
 
-	assert(t, hash == "436ba5c95f06a88236297e5733e89c758b3528753a592eeb305110f29821f7ab")
+	assert(t, hash == "44146453d18681fff48afbb1784b522a5cc1ea306fae59d4e82af82d5ac3e97c")
 }
 
 func TestHeader_Verify(t *testing.T) {
 	assert(t, testHeaders[0].Verify())
 	assert(t, !testHeaders[1].Verify())
 }
+
+func TestHeader_VerifyAuthority(t *testing.T) {
+	bot := testPrv.SubKey("build-bot")
+	s := applyCommit(newTestIFS(), "commit1")
+	b := mustVal(NewCommitBuilder(s))
+	must(b.Delegate(bot.PublicKey(), "/releases/"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+	prev := s.Root()
+
+	// the owner
+	r := prev.Copy()
+	r.SetInt(headerVer, prev.Ver()+1)
+	must(r.Sign(testPrv))
+	assert(t, r.Verify())
+	assert(t, r.VerifyAuthority(prev))
+
+	// the delegate
+	must(r.SignAsDelegate(bot))
+	assert(t, !r.Verify())
+	assert(t, r.VerifyAuthority(prev))
+	assert(t, !r.VerifyAuthority(NewRootHeader(testPub))) // not delegated
+
+	// a forged root-header signed by an unknown key
+	must(r.SignAsDelegate(crypto.NewPrivateKeyFromSeed("attacker")))
+	assert(t, !r.Verify())
+	assert(t, !r.VerifyAuthority(prev))
+}
+
+// testFailingSigner is a signer of an unavailable device
+type testFailingSigner struct{ pub crypto.PublicKey }
+
+var errTestNoDevice = errors.New("no device")
+
+func (s testFailingSigner) PublicKey() crypto.PublicKey { return s.pub }
+
+func (testFailingSigner) SignDigest([]byte) ([]byte, error) {
+	return nil, errTestNoDevice
+}
+
+func TestHeader_Sign_signer(t *testing.T) {
+	h := testHeaders[0].Copy()
+	err := h.Sign(crypto.NewCommandSigner(testPub, "false"))
+	assert(t, err != nil && !h.Verify())
+
+	s := newTestIFS()
+	_, err = MakeCommit(s, testFailingSigner{testPub}, test_data.FS("commit1"), testCommitTime)
+	assert(t, errors.Is(err, errTestNoDevice))
+}
+
+func TestHeader_Sign_schemes(t *testing.T) {
+	for _, scheme := range []crypto.Scheme{crypto.Ed25519ph, crypto.ECDSAP256} {
+		prv := crypto.NewPrivateKey(scheme, "private-key-seed")
+		h := testHeaders[0].Copy()
+		must(h.Sign(prv))
+		assert(t, h.Verify())
+		assert(t, h.PublicKey().Equal(prv.PublicKey()))
+
+		// the filesystem of the key
+		s := mustVal(OpenFS(prv.PublicKey(), memdb.New()))
+		must(s.Commit(mustVal(MakeCommit(s, prv, test_data.FS("commit1"), testCommitTime))))
+		assert(t, s.Root().Verify() && s.Root().PublicKey().Equal(prv.PublicKey()))
+		assert(t, mustVal(s.(Scrubber).Scrub(nil)).OK())
+
+		h.Set("Title", "changed")
+		assert(t, !h.Verify())
+	}
+}
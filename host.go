@@ -0,0 +1,274 @@
+package indifs
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/hex"
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"github.com/indifs/indifs/database"
+	"sync"
+)
+
+// Host manages filesystems of many public keys stored in the same database.Storage.
+//
+// The list of followed public keys is kept in the storage. Filesystems are opened lazily
+// (see Host.Open); the least recently used ones are evicted when more than MaxOpen of them are open.
+// Filesystems in use (not closed handles returned by Open, watchers) are not evicted.
+// A filesystem closed by Unfollow or Drop stays readable, but it rejects new commits with ErrClosed.
+type Host struct {
+	db      database.Storage
+	opts    []Option
+	maxOpen int
+
+	mx     sync.Mutex
+	open   map[string]*list.Element // *fileSystem by table id
+	lru    *list.List               // open filesystems; the most recently used first
+	refs   map[*fileSystem]int      // number of not closed handles of the filesystem
+	openMx sync.Mutex               // serializes opening and dropping of filesystems
+}
+
+// hostFS is the handle of the filesystem opened by Host
+type hostFS struct {
+	*fileSystem
+	host *Host
+	once sync.Once
+}
+
+const (
+	dbTableHost     = "host"
+	dbKeyHostPrefix = "fs/" // fs/<hex public key>
+)
+
+var (
+	// ErrClosed is returned by commits to the filesystem unfollowed or dropped by Host
+	ErrClosed = errors.New("filesystem is closed")
+
+	errInvalidPublicKey = errors.New("invalid public key")
+)
+
+// NewHost creates a host of filesystems; maxOpen limits the number of open filesystems (0 – unlimited).
+// Options are applied to every opened filesystem.
+func NewHost(db database.Storage, maxOpen int, opts ...Option) *Host {
+	return &Host{
+		db:      db,
+		opts:    opts,
+		maxOpen: maxOpen,
+		open:    map[string]*list.Element{},
+		lru:     list.New(),
+		refs:    map[*fileSystem]int{},
+	}
+}
+
+func isValidPublicKey(pub crypto.PublicKey) bool {
+	return crypto.DecodePublicKey(pub.Encode()) != nil
+}
+
+func hostKey(pub crypto.PublicKey) string {
+	return dbKeyHostPrefix + hex.EncodeToString(pub)
+}
+
+// List returns public keys of followed filesystems
+// (database.ErrNotSupported if the storage doesn't implement database.KeyLister)
+func (h *Host) List() (pubs []crypto.PublicKey, err error) {
+	keys, err := database.Keys(h.db, dbTableHost, dbKeyHostPrefix)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		if pub, err := hex.DecodeString(key[len(dbKeyHostPrefix):]); err == nil {
+			pubs = append(pubs, pub)
+		}
+	}
+	return
+}
+
+// Follows says the filesystem of the public key is followed
+func (h *Host) Follows(pub crypto.PublicKey) bool {
+	r, err := h.db.OpenAt(dbTableHost, hostKey(pub), 0)
+	if err == nil {
+		r.Close()
+	}
+	return err == nil
+}
+
+// Follow adds the public key to the list of hosted filesystems
+func (h *Host) Follow(pub crypto.PublicKey) error {
+	if !isValidPublicKey(pub) {
+		return errInvalidPublicKey
+	}
+	return h.db.Execute(dbTableHost, func(tx database.Transaction) error {
+		return tx.Put(hostKey(pub), 0, bytes.NewReader(nil))
+	})
+}
+
+// Unfollow removes the public key from the list of hosted filesystems; stored data is kept (see Drop).
+func (h *Host) Unfollow(pub crypto.PublicKey) error {
+	if !isValidPublicKey(pub) {
+		return errInvalidPublicKey
+	}
+	h.openMx.Lock()
+	defer h.openMx.Unlock()
+
+	if err := h.unfollow(pub); err != nil {
+		return err
+	}
+	h.close(fsTableID(pub))
+	return nil
+}
+
+// Drop unfollows the filesystem and deletes its data from the storage
+func (h *Host) Drop(pub crypto.PublicKey) (err error) {
+	if !isValidPublicKey(pub) {
+		return errInvalidPublicKey
+	}
+	h.openMx.Lock()
+	defer h.openMx.Unlock()
+
+	if err = h.unfollow(pub); err != nil {
+		return
+	}
+	f := h.close(fsTableID(pub))
+	if f == nil {
+		if f, err = openFS(pub, h.db, h.opts); err != nil {
+			return
+		}
+	}
+	return f.drop()
+}
+
+func (h *Host) unfollow(pub crypto.PublicKey) error {
+	return h.db.Execute(dbTableHost, func(tx database.Transaction) error {
+		return tx.Delete(hostKey(pub))
+	})
+}
+
+// Open returns the filesystem of the followed public key.
+// The result implements io.Closer; the filesystem is not evicted until it is closed.
+func (h *Host) Open(pub crypto.PublicKey) (IFS, error) {
+	if !isValidPublicKey(pub) {
+		return nil, errInvalidPublicKey
+	}
+	id := fsTableID(pub)
+	if f := h.get(id); f != nil {
+		return f, nil
+	}
+	h.openMx.Lock()
+	defer h.openMx.Unlock()
+
+	if f := h.get(id); f != nil {
+		return f, nil
+	}
+	if !h.Follows(pub) {
+		return nil, ErrNotFound
+	}
+	f, err := openFS(pub, h.db, h.opts)
+	if err != nil {
+		return nil, err
+	}
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.open[id] = h.lru.PushFront(f)
+	hf := h.handle(f)
+	h.evict()
+	return hf, nil
+}
+
+// get returns the new handle of the open filesystem
+func (h *Host) get(id string) *hostFS {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if e := h.open[id]; e != nil {
+		h.lru.MoveToFront(e)
+		return h.handle(e.Value.(*fileSystem))
+	}
+	return nil
+}
+
+func (h *Host) handle(f *fileSystem) *hostFS {
+	h.refs[f]++
+	return &hostFS{fileSystem: f, host: h}
+}
+
+// Close releases the filesystem; it can be evicted by Host when all its handles are closed
+func (f *hostFS) Close() error {
+	f.once.Do(func() {
+		h := f.host
+		h.mx.Lock()
+		defer h.mx.Unlock()
+		if h.refs[f.fileSystem]--; h.refs[f.fileSystem] <= 0 {
+			delete(h.refs, f.fileSystem)
+		}
+		h.evict()
+	})
+	return nil
+}
+
+// close removes the filesystem from the open ones
+func (h *Host) close(id string) *fileSystem {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	e := h.open[id]
+	if e == nil {
+		return nil
+	}
+	delete(h.open, id)
+	h.lru.Remove(e)
+	f := e.Value.(*fileSystem)
+	f.close()
+	return f
+}
+
+// evict closes the least recently used filesystems; filesystems in use (open handles, watchers) are not evicted
+func (h *Host) evict() {
+	for e := h.lru.Back(); e != nil && h.maxOpen > 0 && h.lru.Len() > h.maxOpen; {
+		prev := e.Prev()
+		if f := e.Value.(*fileSystem); h.refs[f] == 0 && !f.watched() {
+			delete(h.open, f.id)
+			h.lru.Remove(e)
+			f.close()
+		}
+		e = prev
+	}
+}
+
+// close rejects further commits to the filesystem
+func (f *fileSystem) close() {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.closed = true
+}
+
+func (f *fileSystem) watched() bool {
+	f.watchMx.Lock()
+	defer f.watchMx.Unlock()
+	return len(f.watchers) > 0
+}
+
+// drop deletes the filesystem table and releases its file contents
+func (f *fileSystem) drop() (err error) {
+	defer recoverError(&err)
+	f.commitMx.Lock()
+	defer f.commitMx.Unlock()
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.closed = true
+	refs := fileRefs(f.nodes)
+	for _, v := range f.versions {
+		for merkle, n := range fileRefs(f.versionTree(v.Ver())) {
+			refs[merkle] += n
+		}
+	}
+	for merkle, n := range refs {
+		refs[merkle] = -n
+	}
+	must(f.parts.execute(func(tx *partsTx) {
+		tx.putPending(f.id, newPendingRefs(nil, refs))
+	}))
+	must(f.db.Drop(f.id))
+	f.nodes, f.versions = mustVal(indexTree([]Header{NewRootHeader(f.pub)})), nil
+
+	// (on failure the references are released when the filesystem is opened again)
+	return f.reconcileParts()
+}
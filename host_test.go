@@ -0,0 +1,84 @@
+package indifs
+
+import (
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"github.com/indifs/indifs/database"
+	"github.com/indifs/indifs/database/memdb"
+	"github.com/indifs/indifs/test_data"
+	"io"
+	"testing"
+)
+
+func TestHost(t *testing.T) {
+	db := memdb.New()
+	h := NewHost(db, 1)
+	prv2 := crypto.NewPrivateKeyFromSeed("private-key-seed-2")
+	pub2 := prv2.PublicKey()
+
+	_, err := h.Open(testPub)
+	assert(t, err == ErrNotFound)
+
+	must(h.Follow(testPub))
+	must(h.Follow(pub2))
+	assert(t, len(mustVal(h.List())) == 2)
+	assert(t, h.Follows(pub2))
+	assert(t, h.Follow(crypto.PublicKey("bad")) != nil)
+
+	s1 := applyCommit(mustVal(h.Open(testPub)), "commit1")
+	s1b := mustVal(h.Open(testPub))
+	assert(t, hostFSOf(s1b) == hostFSOf(s1))
+	must(s1b.(io.Closer).Close())
+	readme := mustVal(s1.FileHeader("/readme.txt"))
+
+	//--- eviction
+	s2 := mustVal(h.Open(pub2))
+	must(s2.Commit(mustVal(MakeCommit(s2, prv2, test_data.FS("commit1"), testCommitTime))))
+	assert(t, testFileRefs(db, readme.MerkleHash()) == 2)
+
+	// the filesystem in use is not evicted
+	applyCommit(s1, "commit2")
+	assert(t, s1.Root().Ver() == 2)
+
+	// the filesystem is evicted when all its handles are closed
+	must(s1.(io.Closer).Close())
+	s1a := mustVal(h.Open(testPub))
+	assert(t, hostFSOf(s1a) != hostFSOf(s1))
+	assert(t, s1a.Root().Ver() == 2)
+	err = s1.Commit(makeTestCommit(s1, "commit3"))
+	assert(t, errors.Is(err, ErrClosed))
+	must(s2.(io.Closer).Close())
+
+	// watched filesystems are not evicted
+	cancel := s1a.Watch("", func(*ChangeEvent) {})
+	must(s1a.(io.Closer).Close())
+	s2a := mustVal(h.Open(pub2))
+	assert(t, hostFSOf(s2a) != hostFSOf(s2))
+	must(s2a.(io.Closer).Close())
+	assert(t, hostFSOf(mustVal(h.Open(testPub))) == hostFSOf(s1a))
+	cancel()
+
+	//--- unfollow
+	must(h.Unfollow(testPub))
+	assert(t, !h.Follows(testPub))
+	_, err = h.Open(testPub)
+	assert(t, err == ErrNotFound)
+
+	must(h.Follow(testPub))
+	assert(t, mustVal(h.Open(testPub)).Root().Ver() == 2)
+
+	//--- drop
+	must(h.Drop(pub2))
+	assert(t, equal(mustVal(h.List()), []crypto.PublicKey{testPub}))
+	assert(t, testFileRefs(db, readme.MerkleHash()) == 0)
+	assert(t, len(mustVal(database.Keys(db, fsTableID(pub2), ""))) == 0)
+	_, err = io.ReadAll(mustVal(mustVal(h.Open(testPub)).OpenAt("/A/1.txt", 0))) // shared content is kept
+	assert(t, err == nil)
+
+	must(h.Follow(pub2))
+	assert(t, mustVal(h.Open(pub2)).Root().Ver() == 0)
+}
+
+func hostFSOf(f IFS) *fileSystem {
+	return f.(*hostFS).fileSystem
+}
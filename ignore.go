@@ -0,0 +1,106 @@
+package indifs
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+)
+
+// IgnoreFileName is the name of files with gitignore-style patterns of paths excluded by MakeCommit.
+//
+// Patterns of a file are applied to the directory containing the file and all its subdirectories;
+// patterns of deeper files and later lines take precedence. Supported syntax:
+//
+//	# comment
+//	*.log        – matches names at any level (wildcards of path.Match)
+//	build/       – matches directories only
+//	/secret.txt  – a pattern with a slash is matched relative to the directory of the ignore file
+//	docs/**/tmp  – "**" matches any number of directories
+//	!keep.log    – negation: re-includes a path excluded by previous patterns
+//
+// Like in git, a path can`t be re-included if its parent directory is excluded.
+const IgnoreFileName = ".ifsignore"
+
+type ignoreRule struct {
+	base     string   // dir of the ignore file (IFS-path)
+	pattern  []string // pattern segments
+	negate   bool
+	dirOnly  bool
+	anchored bool // pattern is matched against the path relative to base (otherwise – against the name)
+}
+
+// WithExclude excludes paths from the commit (in addition to IgnoreFileName patterns).
+// The function gets IFS-path; paths of directories end with "/".
+func WithExclude(fn func(path string) bool) CommitOption {
+	return func(cfg *commitConfig) {
+		cfg.exclude = fn
+	}
+}
+
+func parseIgnoreRules(base string, data []byte) (rules []ignoreRule) {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		r := ignoreRule{base: base}
+		if line[0] == '!' {
+			r.negate, line = true, line[1:]
+		} else if line[0] == '\\' { // escaped "#" or "!"
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		r.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+		r.pattern = strings.Split(line, "/")
+		rules = append(rules, r)
+	}
+	return
+}
+
+// isIgnored says the IFS-path is excluded by the rules
+func isIgnored(rules []ignoreRule, ifsPath string) (ignored bool) {
+	dir := isDir(ifsPath)
+	for _, r := range rules {
+		if r.dirOnly && !dir || !strings.HasPrefix(ifsPath, r.base) {
+			continue
+		}
+		rel := strings.Split(strings.Trim(ifsPath[len(r.base):], "/"), "/")
+		var ok bool
+		if r.anchored {
+			ok = matchSegments(r.pattern, rel)
+		} else {
+			ok = matchSegments(r.pattern, rel[len(rel)-1:])
+		}
+		if ok {
+			ignored = !r.negate
+		}
+	}
+	return
+}
+
+func matchSegments(pattern, names []string) bool {
+	if len(pattern) == 0 {
+		return len(names) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if matchSegments(pattern[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	ok, err := path.Match(pattern[0], names[0])
+	return ok && err == nil && matchSegments(pattern[1:], names[1:])
+}
@@ -0,0 +1,61 @@
+package indifs
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMakeCommit_ignore(t *testing.T) {
+	src := fstest.MapFS{
+		".ifsignore":       {Data: []byte("# comment\n*.log\n!keep.log\nbuild/\n/secret.txt\ndocs/**/tmp\n")},
+		"a.log":            {Data: []byte("a")},
+		"keep.log":         {Data: []byte("b")},
+		"main.go":          {Data: []byte("c")},
+		"secret.txt":       {Data: []byte("d")},
+		"build/x.bin":      {Data: []byte("e")},
+		"src/build/y.bin":  {Data: []byte("f")},
+		"src/build.txt":    {Data: []byte("g")},
+		"docs/.ifsignore":  {Data: []byte("draft*\n")},
+		"docs/draft1.md":   {Data: []byte("h")},
+		"docs/readme.md":   {Data: []byte("i")},
+		"docs/secret.txt":  {Data: []byte("j")},
+		"docs/a/b/tmp":     {Data: []byte("k")},
+		"docs/a/b/draft":   {Data: []byte("l")},
+		".git/config":      {Data: []byte("m")},
+		"src/draft-old.go": {Data: []byte("n")},
+	}
+	excludeGit := WithExclude(func(path string) bool {
+		return strings.HasPrefix(path, "/.git/")
+	})
+	s := newTestIFS()
+	must(s.Commit(mustVal(MakeCommit(s, testPrv, src, time.Time{}, excludeGit))))
+
+	var paths []string
+	for _, h := range fsHeaders(s)[1:] {
+		paths = append(paths, h.Path())
+	}
+	assert(t, equal(paths, []string{
+		"/",
+		"/.ifsignore",
+		"/docs/",
+		"/docs/.ifsignore",
+		"/docs/a/",
+		"/docs/a/b/",
+		"/docs/readme.md",
+		"/docs/secret.txt",
+		"/keep.log",
+		"/main.go",
+		"/src/",
+		"/src/build.txt",
+		"/src/draft-old.go",
+	}))
+
+	// ignored files existed in the filesystem are deleted
+	src["main.go"] = &fstest.MapFile{Data: []byte("c")}
+	src["docs/.ifsignore"] = &fstest.MapFile{Data: []byte("draft*\nreadme.md\n")}
+	must(s.Commit(mustVal(MakeCommit(s, testPrv, src, time.Time{}, excludeGit))))
+	assert(t, mustVal(s.FileHeader("/docs/readme.md")).Deleted())
+	assert(t, !mustVal(s.FileHeader("/docs/secret.txt")).Deleted())
+}
@@ -23,6 +23,9 @@ type IFS interface {
 	// FileParts returns hashes of file-parts
 	FileParts(path string) (hashes [][]byte, err error)
 
+	// FilePart returns i-th part of file content with proofs for the root-header Merkle
+	FilePart(path string, i int) (*FilePart, error)
+
 	// OpenAt opens file as descriptor
 	OpenAt(path string, offset int64) (io.ReadCloser, error)
 
@@ -34,13 +37,33 @@ type IFS interface {
 
 	// Commit applies a commit
 	Commit(*Commit) error
+
+	// Watch subscribes to changes of files with the path prefix ("" – all changes).
+	// fn is called after each successful commit when the commit lock is released, one event at a time
+	// in the order of commits (a slow fn delays the next events, not commits). Every call gets its own copy of the event.
+	Watch(prefix string, fn func(*ChangeEvent)) (cancel func())
+
+	// VersionInfo returns the signed root-header and the commit info of the applied version
+	VersionInfo(ver int64) (*VersionInfo, error)
+
+	// Log returns applied versions not greater than fromVer (0 – the current version) in descending order;
+	// limit <= 0 – no limit. Versions received in one commit with a later version are not listed.
+	Log(fromVer int64, limit int) ([]*VersionInfo, error)
+
+	// Equivocations returns proofs that the owner has signed different root-headers of the same version
+	Equivocations() ([]*Equivocation, error)
+
+	// OpenVersion returns read-only filesystem of the given version (see WithRetention).
+	// The result implements io.Closer; the version is not pruned until it is closed.
+	OpenVersion(ver int64) (IFS, error)
 }
 
 const (
-	DefaultProtocol = "IndiFS/0.1"
+	DefaultProtocol = "IndiFS/0.2" // (0.2 – Header.Hash covers every field except Signature)
 	protocolPrefix  = "IndiFS/"
 
-	DefaultFilePartSize = 1 << 20 // (1 MiB) – default file part size
+	DefaultFilePartSize = 1 << 20  // (1 MiB) – default file part size
+	MaxFilePartSize     = 16 << 20 // (16 MiB) – max file part size
 
 	MaxPathNameLength    = 255
 	MaxPathLevels        = 6
@@ -48,8 +71,9 @@ const (
 )
 
 var (
-	ErrNotFound     = errors.New("not found")
-	ErrTooManyFiles = errors.New("too many files")
+	ErrNotFound            = errors.New("not found")
+	ErrTooManyFiles        = errors.New("too many files")
+	ErrUnsupportedProtocol = errors.New("unsupported Protocol version")
 
 	errInvalidHeader = errors.New("invalid header")
 	errInvalidPath   = errors.New("invalid header Path")
@@ -61,6 +85,15 @@ var (
 	errParentDirIsDeleted = errors.New("parent dir is deleted")
 )
 
+// isSupportedProtocol says the protocol version is compatible with DefaultProtocol:
+// the same major version (and the same minor one for the major version 0)
+func isSupportedProtocol(ver string) bool {
+	if protocolVerMajor(ver) == 0 {
+		return protocolVer64(ver) == protocolVer64(DefaultProtocol)
+	}
+	return protocolVerMajor(ver) == protocolVerMajor(DefaultProtocol)
+}
+
 func protocolVerMajor(ver string) uint8 {
 	return uint8(protocolVer64(ver) >> 56)
 }
@@ -2,16 +2,19 @@ package indifs
 
 import (
 	"bytes"
+	"errors"
 	"github.com/indifs/indifs/crypto"
 	"github.com/indifs/indifs/database/memdb"
 	"github.com/indifs/indifs/test_data"
 	"io"
+	"io/fs"
 	"testing"
 	"time"
 )
 
 func Test_protocolVer64(t *testing.T) {
 	assert(t, protocolVer64("IndiFS/0.1") == 0x0000000100000000)
+	assert(t, protocolVer64("IndiFS/0.2") == 0x0000000200000000)
 	assert(t, protocolVer64("UNKNOWN/0.1") == 0xffffffffffffffff)
 }
 
@@ -21,6 +24,25 @@ func Test_protocolVerMajor(t *testing.T) {
 	assert(t, protocolVerMajor("UnknownPrefixFS/0.1") == 255)
 }
 
+func Test_isSupportedProtocol(t *testing.T) {
+	assert(t, isSupportedProtocol(DefaultProtocol))
+	assert(t, !isSupportedProtocol("IndiFS/0.1"))
+	assert(t, !isSupportedProtocol("IndiFS/1.2"))
+	assert(t, !isSupportedProtocol("UNKNOWN/0.2"))
+}
+
+func TestFileSystem_Commit_unsupportedProtocol(t *testing.T) {
+	s := newTestIFS()
+
+	// the commit of the peer on the previous protocol version
+	commit := makeTestCommit(s, "commit1")
+	commit.Headers[0].Set(headerProtocol, "IndiFS/0.1")
+	must(commit.Headers[0].Sign(testPrv))
+	err := s.Commit(commit)
+	assert(t, errors.Is(err, ErrUnsupportedProtocol))
+	assert(t, s.Root().Ver() == 0)
+}
+
 func TestMakeCommit(t *testing.T) {
 
 	s := newTestIFS()
@@ -121,6 +143,16 @@ func TestMakeCommit(t *testing.T) {
 	B2, err := s.FileHeader("/B/2/")
 	assert(t, err != nil)
 	assert(t, B2 == nil)
+
+	//------ repeat commit-3 (deleted nodes are kept; they are not deleted again)
+	commit3A := makeTestCommit(s, "commit3")
+	assert(t, len(commit3A.Headers) == 1)
+	assert(t, bytes.Equal(commit3A.Root().MerkleHash(), commit3.Root().MerkleHash()))
+
+	err = s.Commit(commit3A)
+	assert(t, err == nil)
+	B, err = s.FileHeader("/B/")
+	assert(t, err == nil && B.Deleted() && B.Ver() == 4)
 }
 
 func TestFileSystem_Commit_conflictCommits(t *testing.T) {
@@ -129,7 +161,7 @@ func TestFileSystem_Commit_conflictCommits(t *testing.T) {
 	commitA := makeTestCommit(newTestIFS(), "commit1")
 	commitB := makeTestCommit(newTestIFS(), "commit1")
 	commitB.Headers[0].Add("X", "x")
-	commitB.Headers[0].Sign(testPrv)
+	must(commitB.Headers[0].Sign(testPrv))
 	if bytes.Compare(commitA.Hash(), commitB.Hash()) > 0 {
 		commitA, commitB = commitB, commitA
 	}
@@ -184,6 +216,54 @@ func TestFileSystem_GetCommit(t *testing.T) {
 
 }
 
+func TestFileSystem_Commit_restoreDeletedNode(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1", "commit2", "commit3")
+	B, err := s.FileHeader("/B/")
+	assert(t, err == nil)
+	assert(t, B.Deleted())
+
+	// the deleted directory is restored by the later version
+	commit := makeTestCommit(s, "commit1")
+	err = s.Commit(commit)
+	assert(t, err == nil)
+
+	B, err = s.FileHeader("/B/")
+	assert(t, err == nil)
+	assert(t, !B.Deleted())
+	assert(t, B.Ver() == 4)
+	assert(t, testReadFile(s, "/B/1/1.txt") == string(mustVal(fs.ReadFile(test_data.FS("commit1"), "B/1/1.txt"))))
+
+	// the replica applies the same commit
+	r := applyCommit(newTestIFS(), "commit1", "commit2", "commit3")
+	err = r.Commit(mustVal(s.GetCommit(r.Root().Ver())))
+	assert(t, err == nil)
+	assert(t, equal(fsHeaders(s), fsHeaders(r)))
+}
+
+func TestFileSystem_GetCommit_dirChildren(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1")
+	r := applyCommit(newTestIFS(), "commit1")
+
+	// only the header of the directory is changed
+	b := mustVal(NewCommitBuilder(s))
+	defer b.Close()
+	must(b.SetHeader("/A/", "X-Test", "test"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+
+	// unchanged children of the directory are in the commit, otherwise they are excluded from the replica tree
+	commit, err := s.GetCommit(r.Root().Ver())
+	assert(t, err == nil)
+	var paths []string
+	for _, h := range commit.Headers[1:] {
+		paths = append(paths, h.Path())
+	}
+	assert(t, equal(paths, []string{"/A/", "/A/1.txt", "/A/2.txt"}))
+
+	err = r.Commit(commit)
+	assert(t, err == nil)
+	assert(t, equal(fsHeaders(s), fsHeaders(r)))
+}
+
 func TestFileSystem_FileMerkleProof(t *testing.T) {
 	s := applyCommit(newTestIFS(), "commit1", "commit2")
 	merkleRoot := s.Root().MerkleHash()
@@ -205,10 +285,12 @@ func TestFileSystem_FileMerkleProof(t *testing.T) {
 	}
 }
 
+var testCommitTime = mustVal(time.Parse("2006-01-02 15:04:05", "2024-11-05 00:00:00"))
+
 func makeTestCommit(vfs IFS, commitID string) *Commit {
 	tCommit := vfs.Root().Updated()
 	if tCommit.IsZero() {
-		tCommit = mustVal(time.Parse("2006-01-02 15:04:05", "2024-11-05 00:00:00"))
+		tCommit = testCommitTime
 	} else {
 		tCommit = tCommit.Add(time.Second)
 	}
@@ -216,6 +298,9 @@ func makeTestCommit(vfs IFS, commitID string) *Commit {
 }
 
 func fsHeaders(f IFS) (hh []Header) {
+	if s, ok := f.(*snapshot); ok {
+		return s.headers()
+	}
 	return f.(*fileSystem).headers()
 }
 
@@ -0,0 +1,240 @@
+package indifs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// ioFS is an adapter of IFS to the io/fs interfaces
+type ioFS struct {
+	ifs IFS
+}
+
+// ioFile implements fs.File, io.Seeker and fs.ReadDirFile
+type ioFile struct {
+	fs     *ioFS
+	h      Header
+	offset int64
+	r      io.ReadCloser // (is opened lazily)
+	dd     []fs.DirEntry // directory entries (for directories only)
+	closed bool
+}
+
+// fileInfo implements fs.FileInfo
+type fileInfo struct {
+	h Header
+}
+
+var errIsDir = errors.New("is a directory")
+
+// NewIOFS returns IFS as fs.FS.
+// The result also implements fs.ReadDirFS, fs.StatFS and fs.ReadFileFS; opened files implement io.Seeker.
+func NewIOFS(ifs IFS) fs.FS {
+	return &ioFS{ifs}
+}
+
+// header returns header of the file or directory with the given fs.FS-name
+func (f *ioFS) header(op, name string) (Header, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	path := "/"
+	if name != "." {
+		path += name
+	}
+	h, err := f.ifs.FileHeader(path)
+	if err == ErrNotFound && path != "/" {
+		h, err = f.ifs.FileHeader(path + "/")
+	}
+	if err == nil && h.Deleted() {
+		err = ErrNotFound
+	}
+	if err == ErrNotFound {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return h, nil
+}
+
+func (f *ioFS) Open(name string) (fs.File, error) {
+	h, err := f.header("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &ioFile{fs: f, h: h}, nil
+}
+
+func (f *ioFS) Stat(name string) (fs.FileInfo, error) {
+	h, err := f.header("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{h}, nil
+}
+
+func (f *ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	h, err := f.header("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.readDir(h)
+}
+
+func (f *ioFS) ReadFile(name string) (data []byte, err error) {
+	h, err := f.header("read", name)
+	if err != nil {
+		return
+	}
+	if h.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	r, err := f.ifs.OpenAt(h.Path(), 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	defer r.Close()
+	buf := bytes.NewBuffer(make([]byte, 0, h.FileSize()))
+	if _, err = io.Copy(buf, r); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *ioFS) readDir(h Header) ([]fs.DirEntry, error) {
+	if !h.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: h.Path(), Err: errors.New("not a directory")}
+	}
+	hh, err := f.ifs.ReadDir(h.Path())
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: h.Path(), Err: err}
+	}
+	dd := make([]fs.DirEntry, 0, len(hh))
+	for _, h := range hh {
+		if !h.Deleted() {
+			dd = append(dd, fs.FileInfoToDirEntry(fileInfo{h}))
+		}
+	}
+	sort.Slice(dd, func(i, j int) bool {
+		return dd[i].Name() < dd[j].Name()
+	})
+	return dd, nil
+}
+
+//------------ ioFile ------------
+
+func (f *ioFile) Stat() (fs.FileInfo, error) {
+	return fileInfo{f.h}, nil
+}
+
+func (f *ioFile) Read(buf []byte) (n int, err error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if f.h.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.h.Path(), Err: errIsDir}
+	}
+	if f.offset >= f.h.FileSize() {
+		return 0, io.EOF
+	}
+	if f.r == nil {
+		if f.r, err = f.fs.ifs.OpenAt(f.h.Path(), f.offset); err != nil {
+			return
+		}
+	}
+	n, err = f.r.Read(buf)
+	f.offset += int64(n)
+	return
+}
+
+func (f *ioFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.h.FileSize()
+	default:
+		offset = -1
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.h.Path(), Err: fs.ErrInvalid}
+	}
+	if offset != f.offset && f.r != nil {
+		f.r.Close()
+		f.r = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *ioFile) ReadDir(n int) (dd []fs.DirEntry, err error) {
+	if f.closed {
+		return nil, fs.ErrClosed
+	}
+	if f.dd == nil {
+		if f.dd, err = f.fs.readDir(f.h); err != nil {
+			return
+		}
+	}
+	dd = f.dd[min(f.offset, int64(len(f.dd))):] // (the offset can be set beyond the entries by Seek)
+	if n > 0 && len(dd) > n {
+		dd = dd[:n]
+	}
+	f.offset += int64(len(dd))
+	if n > 0 && len(dd) == 0 {
+		return nil, io.EOF
+	}
+	return
+}
+
+func (f *ioFile) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	if f.r != nil {
+		return f.r.Close()
+	}
+	return nil
+}
+
+//------------ fileInfo ------------
+
+func (fi fileInfo) Name() string {
+	if ss := splitPath(fi.h.Path()); len(ss) > 0 {
+		return ss[len(ss)-1]
+	}
+	return "."
+}
+
+func (fi fileInfo) Size() int64 {
+	return fi.h.FileSize()
+}
+
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (fi fileInfo) ModTime() time.Time {
+	return fi.h.Updated()
+}
+
+func (fi fileInfo) IsDir() bool {
+	return fi.h.IsDir()
+}
+
+func (fi fileInfo) Sys() any {
+	return fi.h
+}
@@ -0,0 +1,91 @@
+package indifs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewIOFS(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1", "commit2", "commit3")
+
+	err := fstest.TestFS(NewIOFS(s),
+		"readme.txt",
+		"index.html",
+		"main.css",
+		"A/1.txt",
+		"A/3.txt",
+		"A/4.txt",
+		"C/1.txt",
+		"C/1/1.txt",
+		"C/1/3.txt",
+		"C/4.txt",
+	)
+	assert(t, err == nil)
+}
+
+func TestNewIOFS_deleted(t *testing.T) {
+	dfs := NewIOFS(applyCommit(newTestIFS(), "commit1", "commit2", "commit3"))
+
+	_, err := fs.Stat(dfs, "B") // deleted dir
+	assert(t, err != nil)
+
+	_, err = fs.ReadFile(dfs, "B/1.txt")
+	assert(t, err != nil)
+
+	dd, err := fs.ReadDir(dfs, ".")
+	assert(t, err == nil)
+	for _, d := range dd {
+		assert(t, d.Name() != "B")
+	}
+}
+
+func TestNewIOFS_seek(t *testing.T) {
+	dfs := NewIOFS(applyCommit(newTestIFS(), "commit1"))
+	data, err := fs.ReadFile(dfs, "A/1.txt")
+	assert(t, err == nil)
+
+	f, err := dfs.Open("A/1.txt")
+	assert(t, err == nil)
+	defer f.Close()
+
+	pos, err := f.(io.Seeker).Seek(-10, io.SeekEnd)
+	assert(t, err == nil)
+	assert(t, pos == int64(len(data)-10))
+
+	tail, err := io.ReadAll(f)
+	assert(t, err == nil)
+	assert(t, string(tail) == string(data[len(data)-10:]))
+
+	st, err := f.Stat()
+	assert(t, err == nil)
+	assert(t, st.Size() == int64(len(data)))
+	assert(t, st.Name() == "1.txt")
+	assert(t, !st.IsDir())
+	assert(t, st.ModTime().Equal(testCommitTime))
+
+	_, err = f.(io.Seeker).Seek(0, 3) // invalid whence
+	assert(t, errors.Is(err, fs.ErrInvalid))
+}
+
+func TestNewIOFS_seekDir(t *testing.T) {
+	dfs := NewIOFS(applyCommit(newTestIFS(), "commit1"))
+	f, err := dfs.Open("A")
+	assert(t, err == nil)
+	defer f.Close()
+
+	// seek beyond the entries
+	_, err = f.(io.Seeker).Seek(10, io.SeekStart)
+	assert(t, err == nil)
+	dd, err := f.(fs.ReadDirFile).ReadDir(-1)
+	assert(t, err == nil && len(dd) == 0)
+	_, err = f.(fs.ReadDirFile).ReadDir(1)
+	assert(t, err == io.EOF)
+
+	_, err = f.(io.Seeker).Seek(0, io.SeekStart)
+	assert(t, err == nil)
+	dd, err = f.(fs.ReadDirFile).ReadDir(-1)
+	assert(t, err == nil && len(dd) == 2)
+}
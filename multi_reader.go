@@ -9,6 +9,12 @@ type multiReader struct {
 
 type openReaderFunc = func() (io.ReadCloser, error)
 
+// fileSkipper is implemented by commit bodies made of separate file contents (such as multiReader),
+// so the content of a file stored already is not read again.
+type fileSkipper interface {
+	skipFile() bool
+}
+
 func newMultiReader() *multiReader {
 	return &multiReader{}
 }
@@ -18,7 +24,7 @@ func (f *multiReader) add(fn openReaderFunc) {
 }
 
 func (f *multiReader) Read(buf []byte) (n int, err error) {
-	for len(buf) > 0 && len(f.ff) > 0 {
+	for len(buf) > 0 && (f.r != nil || len(f.ff) > 0) {
 		if f.r == nil {
 			if f.r, err = f.ff[0](); err != nil {
 				return n, err
@@ -41,6 +47,23 @@ func (f *multiReader) Read(buf []byte) (n int, err error) {
 	return
 }
 
+// skipFile skips the next reader without opening it (see fileSkipper).
+// The current reader has to be read to the end.
+func (f *multiReader) skipFile() bool {
+	if f.r != nil {
+		if n, err := f.r.Read(make([]byte, 1)); n > 0 || err != io.EOF {
+			return false
+		}
+		f.r.Close()
+		f.r = nil
+	}
+	if len(f.ff) == 0 {
+		return false
+	}
+	f.ff = f.ff[1:]
+	return true
+}
+
 func (f *multiReader) Close() (err error) {
 	f.ff = nil
 	if f.r != nil {
@@ -0,0 +1,286 @@
+package indifs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/indifs/indifs/crypto"
+	"github.com/indifs/indifs/database"
+	"io"
+	"strconv"
+)
+
+// partStore is a content-addressed storage of file parts.
+// It is shared by all filesystems of the same database.Storage, so identical parts
+// of different files, versions and filesystems are stored only once.
+//
+// Keys of the parts-table:
+//
+//	part/<hash>        – content of file part; <hash> is hash of the part
+//	part/<hash>.refs   – number of file manifests referencing the part
+//	file/<merkle>      – file manifest (concatenated hashes of file parts); <merkle> is file Merkle-root
+//	file/<merkle>.refs – number of filesystem nodes referencing the file
+//	pending/<table>    – reference changes of the filesystem update in progress (see pendingRefs)
+type partStore struct {
+	db database.Storage
+}
+
+const (
+	dbTableParts = "parts"
+
+	dbKeyPartPrefix = "part/"
+	dbKeyFilePrefix = "file/"
+	dbKeyRefsSuffix = ".refs"
+
+	dbKeyPendingPrefix = "pending/"
+)
+
+// pendingRefs are changes of file references made by an update of the filesystem table.
+// They are saved together with the added references before the table is changed
+// and deleted together with the released references after that, so if the update fails in between,
+// the references are reconciled later (see fileSystem.reconcileParts).
+type pendingRefs struct {
+	Root []byte           `json:"root,omitempty"` // hash of the new root-header (nil – the table is dropped)
+	Refs map[string]int64 `json:"refs"`           // hex Merkle-root of file -> change of the references
+}
+
+// partsTx is a transaction of the parts-table
+type partsTx struct {
+	tx       database.Transaction
+	refs     map[string]int64 // changed reference counters
+	newFiles map[string]bool  // manifests stored in the transaction
+}
+
+func partKey(hash []byte) string {
+	return dbKeyPartPrefix + hex.EncodeToString(hash)
+}
+
+func fileKey(merkle []byte) string {
+	return dbKeyFilePrefix + hex.EncodeToString(merkle)
+}
+
+// fileParts returns hashes of file parts
+func (s partStore) fileParts(merkle []byte) (hashes [][]byte, err error) {
+	r, err := s.db.OpenAt(dbTableParts, fileKey(merkle), 0)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	return splitManifest(data), nil
+}
+
+// open opens file content starting from the offset.
+// If verify is set, each part is checked against its hash before it is returned (see CorruptedPartError).
+func (s partStore) open(path string, merkle []byte, size, partSize, offset int64, verify bool) (io.ReadCloser, error) {
+	hashes, err := s.fileParts(merkle)
+	if err == database.ErrNotFound && verify {
+		return nil, &CorruptedPartError{Path: path, Part: -1}
+	} else if err != nil {
+		return nil, err
+	}
+	if verify {
+		if int64(len(hashes)) != (size+partSize-1)/partSize || !bytes.Equal(crypto.MerkleRoot(hashes...), merkle) {
+			return nil, &CorruptedPartError{Path: path, Part: -1}
+		}
+		return newPartsReader(func(i int) (io.ReadCloser, error) {
+			return s.db.OpenAt(dbTableParts, partKey(hashes[i]), 0)
+		}, path, hashes, size, partSize, offset), nil
+	}
+	w := newMultiReader()
+	for i := offset / partSize; i < int64(len(hashes)); i++ {
+		key, partOffset := partKey(hashes[i]), max(offset-i*partSize, 0)
+		w.add(func() (io.ReadCloser, error) {
+			return s.db.OpenAt(dbTableParts, key, partOffset)
+		})
+	}
+	return w, nil
+}
+
+func (s partStore) execute(fn func(tx *partsTx)) error {
+	return s.db.Execute(dbTableParts, func(tx database.Transaction) (err error) {
+		defer recoverError(&err)
+		t := &partsTx{
+			tx:       tx,
+			refs:     map[string]int64{},
+			newFiles: map[string]bool{},
+		}
+		fn(t)
+		t.flush()
+		return
+	})
+}
+
+func pendingKey(table string) string {
+	return dbKeyPendingPrefix + table
+}
+
+// pending returns unfinished reference changes of the filesystem table (nil if there are none)
+func (s partStore) pending(table string) (p *pendingRefs, err error) {
+	r, err := s.db.OpenAt(dbTableParts, pendingKey(table), 0)
+	if err == database.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err == nil {
+		err = json.Unmarshal(data, &p)
+	}
+	return
+}
+
+func newPendingRefs(root []byte, refs map[string]int64) *pendingRefs {
+	p := &pendingRefs{Root: root, Refs: make(map[string]int64, len(refs))}
+	for merkle, n := range refs {
+		p.Refs[hex.EncodeToString([]byte(merkle))] = n
+	}
+	return p
+}
+
+func (t *partsTx) putPending(table string, p *pendingRefs) {
+	data := mustVal(json.Marshal(p))
+	must(t.tx.Put(pendingKey(table), int64(len(data)), bytes.NewReader(data)))
+}
+
+// finishPending applies the pending changes: if done, the released references are removed;
+// otherwise the added ones are (the update of the filesystem table has failed).
+func (t *partsTx) finishPending(table string, p *pendingRefs, done bool) {
+	for key, n := range p.Refs {
+		merkle := mustVal(hex.DecodeString(key))
+		if done && n < 0 {
+			t.releaseFile(merkle, -n)
+		} else if !done && n > 0 {
+			t.releaseFile(merkle, n)
+		}
+	}
+	must(t.tx.Delete(pendingKey(table)))
+}
+
+func (t *partsTx) getRefs(key string) int64 {
+	if n, ok := t.refs[key]; ok {
+		return n
+	}
+	r, err := t.tx.OpenAt(key+dbKeyRefsSuffix, 0)
+	if err == database.ErrNotFound {
+		return 0
+	}
+	defer r.Close()
+	n, _ := strconv.ParseInt(string(mustVal(io.ReadAll(mustVal(r, err)))), 10, 64)
+	return n
+}
+
+func (t *partsTx) addRefs(key string, n int64) int64 {
+	n += t.getRefs(key)
+	if n < 0 {
+		n = 0
+	}
+	t.refs[key] = n
+	return n
+}
+
+func (t *partsTx) flush() {
+	for key, n := range t.refs {
+		if n > 0 {
+			v := strconv.FormatInt(n, 10)
+			must(t.tx.Put(key+dbKeyRefsSuffix, int64(len(v)), bytes.NewBufferString(v)))
+		} else {
+			must(t.tx.Delete(key + dbKeyRefsSuffix))
+		}
+	}
+}
+
+func (t *partsTx) hasFile(merkle []byte) bool {
+	key := fileKey(merkle)
+	return t.newFiles[key] || t.getRefs(key) > 0
+}
+
+// putFile reads file content, verifies it and stores missing parts and the file manifest.
+// If the content is stored already, it is skipped when the body allows it (see fileSkipper) or verified only.
+func (t *partsTx) putFile(r io.Reader, size, partSize int64, merkle []byte) {
+	require(partSize > 0 && partSize <= MaxFilePartSize, "invalid commit-header Part-Size")
+	stored := t.hasFile(merkle)
+	if s, ok := r.(fileSkipper); ok && stored && s.skipFile() {
+		return
+	}
+	r = io.LimitReader(r, size)
+
+	if stored { // verify only
+		w := crypto.NewMerkleHash(partSize)
+		require(mustVal(io.Copy(w, r)) == size, "invalid commit-content")
+		require(bytes.Equal(w.Root(), merkle), "invalid commit-header Merkle")
+		return
+	}
+	var hashes [][]byte
+	buf := make([]byte, min(partSize, size))
+	for n := int64(0); n < size; {
+		part := buf[:min(partSize, size-n)]
+		_, err := io.ReadFull(r, part)
+		require(err != io.EOF && err != io.ErrUnexpectedEOF, "invalid commit-content")
+		must(err)
+		n += int64(len(part))
+
+		hash := crypto.Hash(part)
+		key := partKey(hash)
+		if t.getRefs(key) == 0 {
+			must(t.tx.Put(key, int64(len(part)), bytes.NewReader(part)))
+		}
+		t.addRefs(key, 1)
+		hashes = append(hashes, hash)
+	}
+	require(bytes.Equal(crypto.MerkleRoot(hashes...), merkle), "invalid commit-header Merkle")
+
+	key := fileKey(merkle)
+	manifest := bytes.Join(hashes, nil)
+	must(t.tx.Put(key, int64(len(manifest)), bytes.NewReader(manifest)))
+	t.newFiles[key] = true
+}
+
+// addFileRefs adds n references to the stored file
+func (t *partsTx) addFileRefs(merkle []byte, n int64) {
+	require(t.hasFile(merkle), "file content not found")
+	t.addRefs(fileKey(merkle), n)
+}
+
+// releaseFile removes n references to the file; deletes the file content if it is not referenced anymore
+func (t *partsTx) releaseFile(merkle []byte, n int64) {
+	key := fileKey(merkle)
+	if t.addRefs(key, -n) > 0 {
+		return
+	}
+	r, err := t.tx.OpenAt(key, 0)
+	if err == database.ErrNotFound {
+		return
+	}
+	manifest := mustVal(io.ReadAll(mustVal(r, err)))
+	r.Close()
+	for _, hash := range splitManifest(manifest) {
+		if pKey := partKey(hash); t.addRefs(pKey, -1) == 0 {
+			must(t.tx.Delete(pKey))
+		}
+	}
+	must(t.tx.Delete(key))
+	delete(t.newFiles, key)
+}
+
+func splitManifest(data []byte) (hashes [][]byte) {
+	for ; len(data) >= crypto.HashSize; data = data[crypto.HashSize:] {
+		hashes = append(hashes, data[:crypto.HashSize])
+	}
+	return
+}
+
+// fileRefs counts references to file contents in the tree
+func fileRefs(tree map[string]*fsNode) map[string]int64 {
+	refs := map[string]int64{}
+	for _, nd := range tree {
+		if merkle := nd.Header.MerkleHash(); !nd.isDir() && !nd.Header.Deleted() && len(merkle) > 0 {
+			refs[string(merkle)]++
+		}
+	}
+	return refs
+}
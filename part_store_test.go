@@ -0,0 +1,128 @@
+package indifs
+
+import (
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"github.com/indifs/indifs/database"
+	"github.com/indifs/indifs/database/memdb"
+	"github.com/indifs/indifs/test_data"
+	"io"
+	"strconv"
+	"testing"
+)
+
+func TestPartStore_dedup(t *testing.T) {
+	db := memdb.New()
+
+	s1 := applyCommit(mustVal(OpenFS(testPub, db)), "commit1")
+
+	// the same content in different paths is stored once
+	h1 := mustVal(s1.FileHeader("/B/1.txt"))
+	h2 := mustVal(s1.FileHeader("/B/1/1.txt"))
+	assert(t, equal(h1.MerkleHash(), h2.MerkleHash()))
+	assert(t, testFileRefs(db, h1.MerkleHash()) == 2)
+
+	// the same content in different filesystems is stored once
+	prv2 := crypto.NewPrivateKeyFromSeed("private-key-seed-2")
+	s2 := mustVal(OpenFS(prv2.PublicKey(), db))
+	must(s2.Commit(mustVal(MakeCommit(s2, prv2, test_data.FS("commit1"), testCommitTime))))
+	assert(t, testFileRefs(db, h1.MerkleHash()) == 4)
+
+	readme1 := mustVal(s1.FileHeader("/readme.txt"))
+
+	//--- commit-2, commit-3
+	applyCommit(s1, "commit2")
+	a2 := mustVal(s1.FileHeader("/B/2/a.txt"))
+	assert(t, testFileRefs(db, a2.MerkleHash()) == 1)
+
+	applyCommit(s1, "commit3")
+	assert(t, testFileRefs(db, h1.MerkleHash()) == 3) // "/C/1/1.txt" + s2:{"/B/1.txt", "/B/1/1.txt"}
+
+	// unreferenced content is deleted
+	assert(t, testFileRefs(db, a2.MerkleHash()) == 0)
+	_, err := db.OpenAt(dbTableParts, fileKey(a2.MerkleHash()), 0)
+	assert(t, err == database.ErrNotFound)
+
+	// content referenced by another filesystem is kept
+	assert(t, testFileRefs(db, readme1.MerkleHash()) == 1)
+	r, err := s2.OpenAt("/readme.txt", 0)
+	assert(t, err == nil)
+	data, err := io.ReadAll(r)
+	assert(t, err == nil)
+	assert(t, int64(len(data)) == readme1.FileSize())
+}
+
+func TestPartStore_pending(t *testing.T) {
+	db := memdb.New()
+	s := applyCommit(mustVal(OpenFS(testPub, db)), "commit1")
+	readme1 := mustVal(s.FileHeader("/readme.txt")) // changed by commit-2
+	commit := makeTestCommit(s, "commit2")
+
+	//--- the filesystem table can't be updated: added references are removed
+	fdb := &failingDB{Storage: db, table: fsTableID(testPub)}
+	s = mustVal(OpenFS(testPub, fdb))
+	err := s.Commit(commit)
+	assert(t, err == errTestFailure)
+	assert(t, s.Root().Ver() == 1)
+	assert(t, testFileRefs(db, readme1.MerkleHash()) == 1)
+	_, err = db.OpenAt(dbTableParts, pendingKey(fsTableID(testPub)), 0)
+	assert(t, err == database.ErrNotFound)
+
+	//--- old content can't be released: it is released when the filesystem is opened again
+	fdb = &failingDB{Storage: db, table: dbTableParts, n: 1}
+	s = mustVal(OpenFS(testPub, fdb))
+	commit = makeTestCommit(s, "commit2")
+	err = s.Commit(commit)
+	assert(t, err == errTestFailure)
+	assert(t, s.Root().Ver() == 2)
+	assert(t, testFileRefs(db, readme1.MerkleHash()) == 1)
+
+	s = mustVal(OpenFS(testPub, db))
+	assert(t, s.Root().Ver() == 2)
+	assert(t, testFileRefs(db, readme1.MerkleHash()) == 0)
+	_, err = db.OpenAt(dbTableParts, pendingKey(fsTableID(testPub)), 0)
+	assert(t, err == database.ErrNotFound)
+}
+
+func TestFileSystem_OpenAt(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1")
+
+	r, err := s.OpenAt("/A/1.txt", 2)
+	assert(t, err == nil)
+	data, err := io.ReadAll(r)
+	assert(t, err == nil)
+	assert(t, string(data) == string(mustVal(io.ReadAll(mustVal(test_data.FS("commit1").Open("A/1.txt")))))[2:])
+
+	_, err = s.OpenAt("/A/", 0)
+	assert(t, err == ErrNotFound)
+	_, err = s.OpenAt("/A/unknown.txt", 0)
+	assert(t, err == ErrNotFound)
+}
+
+func testFileRefs(db database.Storage, merkle []byte) int64 {
+	r, err := db.OpenAt(dbTableParts, fileKey(merkle)+dbKeyRefsSuffix, 0)
+	if err == database.ErrNotFound {
+		return 0
+	}
+	n, _ := strconv.ParseInt(string(mustVal(io.ReadAll(mustVal(r, err)))), 10, 64)
+	return n
+}
+
+var errTestFailure = errors.New("test failure")
+
+// failingDB fails transactions of the table after n successful ones
+type failingDB struct {
+	database.Storage
+	table string
+	n     int
+}
+
+func (db *failingDB) Execute(table string, fn func(database.Transaction) error) error {
+	if table == db.table {
+		if db.n == 0 {
+			return errTestFailure
+		}
+		db.n--
+	}
+	return db.Storage.Execute(table, fn)
+}
@@ -0,0 +1,119 @@
+package indifs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/indifs/indifs/crypto"
+	"github.com/indifs/indifs/database"
+	"io"
+)
+
+// ErrCorrupted is the error wrapped by CorruptedPartError
+var ErrCorrupted = errors.New("corrupted data")
+
+// CorruptedPartError reports a file part which content doesn't match its hash.
+type CorruptedPartError struct {
+	Path   string // file path
+	Part   int    // part index; -1 if the part hashes don't match the file Merkle
+	Offset int64  // offset of the part in the file
+}
+
+func (e *CorruptedPartError) Error() string {
+	if e.Part < 0 {
+		return fmt.Sprintf("%v: %s (file Merkle)", ErrCorrupted, e.Path)
+	}
+	return fmt.Sprintf("%v: %s (part %d, offset %d)", ErrCorrupted, e.Path, e.Part, e.Offset)
+}
+
+func (e *CorruptedPartError) Unwrap() error {
+	return ErrCorrupted
+}
+
+// partsReader reads file parts one by one and verifies each part against its hash
+// before the part data is returned to the caller.
+type partsReader struct {
+	openPart func(i int) (io.ReadCloser, error) // opens part i
+	path     string
+	hashes   [][]byte // hashes of all file parts
+	size     int64    // file size
+	partSize int64
+	i        int    // index of the next part
+	skip     int64  // number of bytes to skip in the next part
+	part     []byte // buffer of the current part
+	buf      []byte // verified data of the current part
+	err      error
+}
+
+// newPartsReader returns reader of the file content starting from offset
+func newPartsReader(openPart func(i int) (io.ReadCloser, error), path string, hashes [][]byte, size, partSize, offset int64) *partsReader {
+	return &partsReader{
+		openPart: openPart,
+		path:     path,
+		hashes:   hashes,
+		size:     size,
+		partSize: partSize,
+		i:        int(offset / partSize),
+		skip:     offset % partSize,
+	}
+}
+
+func (r *partsReader) Read(p []byte) (n int, err error) {
+	for len(r.buf) == 0 && r.err == nil {
+		r.err = r.nextPart()
+	}
+	if len(r.buf) == 0 {
+		return 0, r.err
+	}
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return
+}
+
+func (r *partsReader) Close() error {
+	r.err = io.ErrClosedPipe
+	return nil
+}
+
+func (r *partsReader) nextPart() error {
+	if r.i >= len(r.hashes) {
+		return io.EOF
+	}
+	offset := int64(r.i) * r.partSize
+	corrupted := &CorruptedPartError{Path: r.path, Part: r.i, Offset: offset}
+	partLen := min(r.partSize, r.size-offset)
+	if partLen <= 0 {
+		return corrupted
+	}
+	if int64(cap(r.part)) < partLen {
+		r.part = make([]byte, partLen)
+	}
+	part := r.part[:partLen]
+	if err := r.readPart(part); err == io.EOF || err == io.ErrUnexpectedEOF || errors.Is(err, database.ErrNotFound) {
+		return corrupted
+	} else if err != nil {
+		return err
+	}
+	if !bytes.Equal(crypto.Hash(part), r.hashes[r.i]) {
+		return corrupted
+	}
+	r.buf = part[r.skip:]
+	r.skip = 0
+	r.i++
+	return nil
+}
+
+func (r *partsReader) readPart(part []byte) error {
+	pr, err := r.openPart(r.i)
+	if err != nil {
+		return err
+	}
+	defer pr.Close()
+	if _, err = io.ReadFull(pr, part); err != nil {
+		return err
+	}
+	if n, _ := pr.Read(make([]byte, 1)); n > 0 { // the part is longer than expected
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package indifs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"github.com/indifs/indifs/database"
+	"github.com/indifs/indifs/database/memdb"
+	"io"
+	"testing"
+)
+
+func TestPartsReader(t *testing.T) {
+	data := make([]byte, 250) // 3 parts
+	for i := range data {
+		data[i] = byte(i)
+	}
+	hashes := crypto.NewMerkleHash(100)
+	hashes.Write(data)
+	merkle := hashes.Root()
+
+	s := partStore{memdb.New()}
+	must(s.execute(func(tx *partsTx) {
+		tx.putFile(bytes.NewReader(data), 250, 100, merkle)
+		tx.addFileRefs(merkle, 1)
+	}))
+
+	r, err := s.open("/a.txt", merkle, 250, 100, 120, true)
+	assert(t, err == nil)
+	res, err := io.ReadAll(r)
+	assert(t, err == nil)
+	assert(t, bytes.Equal(res, data[120:]))
+
+	//--- corrupt part 1
+	part := bytes.Clone(data[100:200])
+	part[50]++
+	must(s.db.Execute(dbTableParts, func(tx database.Transaction) error {
+		return tx.Put(partKey(hashes.Leaves()[1]), 100, bytes.NewReader(part))
+	}))
+
+	r, err = s.open("/a.txt", merkle, 250, 100, 50, true)
+	assert(t, err == nil)
+	res, err = io.ReadAll(r)
+	assert(t, bytes.Equal(res, data[50:100])) // part 0 is returned
+	var e *CorruptedPartError
+	assert(t, errors.As(err, &e))
+	assert(t, errors.Is(err, ErrCorrupted))
+	assert(t, e.Path == "/a.txt" && e.Part == 1 && e.Offset == 100)
+}
+
+func TestFileSystem_OpenAt_verifyOnRead(t *testing.T) {
+	db := memdb.New()
+	s := applyCommit(mustVal(OpenFS(testPub, db, WithVerifyOnRead())), "commit1")
+
+	r, err := s.OpenAt("/A/1.txt", 10)
+	assert(t, err == nil)
+	_, err = io.ReadAll(r)
+	assert(t, err == nil)
+
+	//--- corrupt stored part
+	parts := mustVal(s.FileParts("/A/1.txt"))
+	must(db.Execute(dbTableParts, func(tx database.Transaction) error {
+		return tx.Put(partKey(parts[0]), 5, bytes.NewBufferString("Hello"))
+	}))
+
+	r, err = s.OpenAt("/A/1.txt", 10)
+	assert(t, err == nil)
+	data, err := io.ReadAll(r)
+	assert(t, len(data) == 0)
+	assert(t, errors.Is(err, ErrCorrupted))
+
+	// without verification
+	s = mustVal(OpenFS(testPub, db))
+	r, err = s.OpenAt("/A/1.txt", 0)
+	assert(t, err == nil)
+	data, err = io.ReadAll(r)
+	assert(t, err == nil)
+	assert(t, string(data) == "Hello")
+}
@@ -0,0 +1,136 @@
+package indifs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/indifs/indifs/crypto"
+	"io"
+	"time"
+)
+
+var errInvalidTargetVer = errors.New("invalid target version")
+
+// Revert makes the commit restoring the tree of the retained version targetVer (see WithRetention) as a new version.
+// Only changed nodes are included in the commit. Their content is stored in the filesystem already,
+// so applying the commit to it doesn't read the content again; other replicas read it from the body
+// while the target version is retained. Nodes deleted after the target version are restored.
+//
+// The commit info Message is "Revert to version <targetVer>" unless it is set by WithMessage.
+func Revert(ifs IFS, signer crypto.Signer, targetVer int64, opts ...CommitOption) (commit *Commit, err error) {
+	defer recoverError(&err)
+	var cfg commitConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.message == "" {
+		cfg.message = fmt.Sprintf("Revert to version %d", targetVer)
+	}
+	cur := ifs.Root().Copy()
+	require(targetVer > 0 && targetVer < cur.Ver(), errInvalidTargetVer)
+	target := mustVal(ifs.OpenVersion(targetVer))
+	if c, ok := target.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	ver := cur.Ver() + 1
+	author := commitAuthor(cur, signer)
+	ts := cfg.time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	if ts.Unix() <= cur.Updated().Unix() {
+		ts = cur.Updated().Add(time.Second)
+	}
+
+	curHH, curTree := treeHeaders(ifs)
+	targetHH, _ := treeHeaders(target)
+
+	root := setCustomFields(cur, customFields(target.Root()))
+	files := newMultiReader()
+	commit = &Commit{
+		Info:    cfg.newInfo(cur),
+		Headers: []Header{root},
+		Body:    files,
+	}
+	inCommit := map[string]bool{}
+	add := func(h Header) {
+		commit.Headers = append(commit.Headers, h)
+		inCommit[h.Path()] = true
+	}
+	//--- changed and restored nodes
+	for path, h := range targetHH {
+		if c := curHH[path]; !h.Deleted() && (c == nil || c.Deleted() || !equalExceptVersion(c, h)) {
+			h = h.Copy()
+			h.SetInt(headerVer, ver)
+			h.SetTime(headerUpdated, ts)
+			setAuthor(&h, author)
+			add(h)
+		}
+	}
+	//--- unchanged children of changed directories (a directory of the new version replaces all its content)
+	for path, h := range targetHH {
+		if !h.Deleted() && !inCommit[path] && inCommit[dirname(path)] {
+			add(curHH[path])
+		}
+	}
+	//--- deleted nodes (children of deleted directories are skipped)
+	for path, h := range curHH {
+		if !h.Deleted() && !isLive(targetHH[path]) && isLive(targetHH[dirname(path)]) {
+			h = NewHeader(path)
+			h.SetInt(headerVer, ver)
+			h.SetInt(headerDeleted, 1)
+			setAuthor(&h, author)
+			add(h)
+		}
+	}
+	sortHeaders(commit.Headers)
+	for _, h := range commit.Headers {
+		if path := h.Path(); h.FileSize() > 0 {
+			files.add(func() (io.ReadCloser, error) {
+				return target.OpenAt(path, 0)
+			})
+		}
+	}
+
+	//--- set merkle + sign
+	ndRoot := mustVal(indexTree(mergeHeaders(curTree, commit.Headers)))[""]
+	newRoot := &commit.Headers[0]
+	newRoot.SetTime(headerUpdated, ts)
+	newRoot.SetInt(headerVer, ver)
+	newRoot.SetInt(headerVolume, ndRoot.totalVolume())
+	newRoot.SetBytes(headerMerkleHash, ndRoot.childrenMerkleRoot())
+	commit.signRoot(signer)
+	return
+}
+
+// treeHeaders returns headers of existing and deleted nodes of the filesystem (except the root-header) and the tree
+func treeHeaders(ifs IFS) (headers map[string]Header, tree map[string]*fsNode) {
+	headers = map[string]Header{}
+	hh := []Header{ifs.Root()}
+	var walk func(path string)
+	walk = func(path string) {
+		for _, h := range valExcludedNotFound(ifs.ReadDir(path)) {
+			headers[h.Path()], hh = h, append(hh, h)
+			if h.IsDir() && !h.Deleted() {
+				walk(h.Path())
+			}
+		}
+	}
+	walk("")
+	sortHeaders(hh)
+	return headers, mustVal(indexTree(hh))
+}
+
+func isLive(h Header) bool {
+	return h != nil && !h.Deleted()
+}
+
+// equalExceptVersion says the headers are equal except the fields of the version (Ver and Updated)
+func equalExceptVersion(a, b Header) bool {
+	a, b = a.Copy(), b.Copy()
+	for _, name := range []string{headerVer, headerUpdated} {
+		a.Delete(name)
+		b.Delete(name)
+	}
+	return a.String() == b.String()
+}
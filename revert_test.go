@@ -0,0 +1,71 @@
+package indifs
+
+import (
+	"errors"
+	"github.com/indifs/indifs/database"
+	"github.com/indifs/indifs/database/memdb"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRevert(t *testing.T) {
+	db := &countingDB{Storage: memdb.New()}
+	s := mustVal(OpenFS(testPub, db, WithRetention(RetentionPolicy{MaxVersions: 3})))
+	applyCommit(s, "commit1")
+	b := mustVal(NewCommitBuilder(s))
+	must(b.SetHeader("", "Title", "v2"))
+	must(b.SetHeader("/A/", "Color", "red"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+	tree2 := testTreeOf(mustVal(s.OpenVersion(2)))
+
+	applyCommit(s, "commit2", "commit3") // "/B/1/" and "/A/2.txt" are deleted, other files are changed
+	assert(t, !equal(testTreeOf(s), tree2))
+	parts := len(mustVal(database.Keys(db.Storage, dbTableParts, "")))
+
+	commit := mustVal(Revert(s, testPrv, 2))
+	assert(t, commit.Ver() == 5)
+	assert(t, len(commit.Headers) < len(fsHeaders(s)))
+	db.reads = 0
+	must(s.Commit(commit))
+	assert(t, db.reads == 0) // stored content is not read again
+
+	assert(t, equal(testTreeOf(s), tree2))
+	assert(t, s.Root().Get("Title") == "v2")
+	assert(t, mustVal(s.FileHeader("/A/")).Get("Color") == "red")
+	assert(t, mustVal(s.FileHeader("/B/1/")).Ver() == 5) // restored
+	assert(t, mustVal(s.FileHeader("/B/1/")).Updated().Equal(s.Root().Updated()))
+	assert(t, mustVal(s.VersionInfo(5)).Message() == "Revert to version 2")
+	assert(t, len(mustVal(database.Keys(db.Storage, dbTableParts, ""))) <= parts) // stored content is reused
+	assert(t, mustVal(s.(Scrubber).Scrub(nil)).OK())
+
+	// the commit is replicated as usual
+	s2 := applyCommit(newTestIFS(), "commit1")
+	must(s2.Commit(mustVal(s.GetCommit(1))))
+	assert(t, equal(fsHeaders(s2), fsHeaders(s)))
+
+	// reverting to the same tree changes nothing but the root-header
+	must(s.Commit(mustVal(Revert(s, testPrv, 4))))
+	assert(t, equal(testTreeOf(s), testTreeOf(mustVal(s.OpenVersion(4)))))
+	commit = mustVal(Revert(s, testPrv, 4))
+	assert(t, len(commit.Headers) == 1)
+
+	//--- errors
+	_, err := Revert(s, testPrv, 1) // is not retained
+	assert(t, errors.Is(err, ErrNotFound))
+	_, err = Revert(s, testPrv, s.Root().Ver())
+	assert(t, errors.Is(err, errInvalidTargetVer))
+}
+
+// countingDB counts reads of file parts
+type countingDB struct {
+	database.Storage
+	reads int
+}
+
+func (db *countingDB) OpenAt(table, key string, offset int64) (io.ReadCloser, error) {
+	if table == dbTableParts && strings.HasPrefix(key, dbKeyPartPrefix) {
+		db.reads++
+	}
+	return db.Storage.OpenAt(table, key, offset)
+}
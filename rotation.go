@@ -0,0 +1,152 @@
+package indifs
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/indifs/indifs/crypto"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// KeyRotation is a record of the root-header designating the successor of the owner key
+//
+//	Successor: <successor-public-key> <ver> <signature>
+//
+// Every record is signed by the previous owner key (Public-Key of the filesystem for the first one),
+// so the records of the root-header make a chain; the last successor is the owner signing following commits
+// (see SignAsDelegate). Public-Key and the identity of the filesystem are not changed.
+//
+// The chain is append-only: records are never changed or removed, so a replaced key can`t sign commits anymore
+// (see CommitBuilder.RotateKey). The only exception is the revocation by the original key (Public-Key):
+// in an emergency (a compromised successor key) the chain is replaced by a new first record made after the current version.
+// Keys of the chain can`t issue it, so a leaked old key can`t take over the filesystem.
+type KeyRotation struct {
+	Successor crypto.PublicKey
+	Ver       int64  // version of the root-header the record is made in
+	Signature []byte // signature of the previous owner key
+}
+
+var (
+	ErrRevokedKey         = errors.New("key is revoked")
+	errInvalidKeyRotation = errors.New("invalid key rotation")
+)
+
+var keyRotationSignPrefix = []byte("IFS-Key-Rotation:")
+
+func (k KeyRotation) String() string {
+	return k.Successor.Encode() + " " + strconv.FormatInt(k.Ver, 10) + " " + base64.StdEncoding.EncodeToString(k.Signature)
+}
+
+func keyRotationMessage(pub, successor crypto.PublicKey, ver int64) []byte {
+	return crypto.Hash(keyRotationSignPrefix, pub, successor, []byte(strconv.FormatInt(ver, 10)))
+}
+
+func parseKeyRotation(s string) (k KeyRotation, ok bool) {
+	ss := strings.Fields(s)
+	if len(ss) != 3 {
+		return
+	}
+	var err error
+	k.Successor = crypto.DecodePublicKey(ss[0])
+	if k.Ver, err = strconv.ParseInt(ss[1], 10, 64); err != nil {
+		return
+	}
+	if k.Signature, err = base64.StdEncoding.DecodeString(ss[2]); err != nil {
+		return
+	}
+	return k, k.Successor != nil
+}
+
+// KeyRotations returns the chain of key rotations of the root-header (nil if the chain is invalid)
+func (h Header) KeyRotations() (kk []KeyRotation) {
+	pub, prevVer := h.PublicKey(), int64(0)
+	for _, f := range h {
+		if f.Name != headerSuccessor {
+			continue
+		}
+		k, ok := parseKeyRotation(string(f.Value))
+		if !ok || k.Ver <= prevVer || !pub.Verify(keyRotationMessage(h.PublicKey(), k.Successor, k.Ver), k.Signature) {
+			return nil
+		}
+		kk = append(kk, k)
+		pub, prevVer = k.Successor, k.Ver
+	}
+	return
+}
+
+// Owner returns the key of the owner signing the root-header: the last successor (see KeyRotation) or Public-Key.
+// Returns nil if the chain of key rotations is invalid.
+func (h Header) Owner() crypto.PublicKey {
+	kk := h.KeyRotations()
+	if len(kk) == 0 {
+		if h.Has(headerSuccessor) {
+			return nil
+		}
+		return h.PublicKey()
+	}
+	return kk[len(kk)-1].Successor
+}
+
+// ownerKeys returns Public-Key and the successors of the root-header
+func ownerKeys(h Header) []crypto.PublicKey {
+	keys := []crypto.PublicKey{h.PublicKey()}
+	for _, k := range h.KeyRotations() {
+		keys = append(keys, k.Successor)
+	}
+	return keys
+}
+
+// RotateKey designates the successor of the current owner key (see KeyRotation); the signer has to be the owner.
+// The commit is to be signed by the successor.
+// If the signer has the original key (Public-Key) replaced by successors, all successors are revoked.
+func (b *CommitBuilder) RotateKey(signer crypto.Signer, successor crypto.PublicKey) (err error) {
+	defer recoverError(&err)
+	pub := signer.PublicKey()
+	isRevocation := pub.Equal(b.root.PublicKey()) && !pub.Equal(b.root.Owner())
+	require(isRevocation || pub.Equal(b.root.Owner()), ErrNotAuthorized)
+	require(isValidPublicKey(successor) && !slices.ContainsFunc(ownerKeys(b.root), successor.Equal), errInvalidPublicKey)
+	if isRevocation {
+		b.root.Delete(headerSuccessor)
+	}
+
+	k := KeyRotation{
+		Successor: successor,
+		Ver:       b.ver,
+		Signature: mustVal(signer.SignDigest(keyRotationMessage(b.root.PublicKey(), successor, b.ver))),
+	}
+	b.root.Add(headerSuccessor, k.String())
+	return
+}
+
+// verifyKeyRotation verifies changes of the key rotations of the commit root-header c:
+// the chain of the current root-header r is kept unchanged (or replaced by the revocation of the original key),
+// new records are made after the version of r.
+func verifyKeyRotation(r, c Header) {
+	must(keyRotationError(r, c))
+}
+
+// keyRotationError returns the error of the changes of the key rotations of the root-header c (see verifyKeyRotation)
+func keyRotationError(r, c Header) error {
+	if c.Owner() == nil {
+		return errInvalidKeyRotation
+	}
+	rr, cc := r.KeyRotations(), c.KeyRotations()
+	if len(cc) > 0 && cc[0].Ver > r.Ver() { // the first record is new: the revocation by the original key
+		rr = nil
+	}
+	if len(cc) < len(rr) {
+		return ErrRevokedKey
+	}
+	for i, k := range rr {
+		if cc[i].String() != k.String() {
+			return ErrRevokedKey
+		}
+	}
+	for _, k := range cc[len(rr):] {
+		if k.Ver <= r.Ver() || k.Ver > c.Ver() {
+			return errInvalidKeyRotation
+		}
+	}
+	return nil
+}
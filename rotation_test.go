@@ -0,0 +1,116 @@
+package indifs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeyRotation(t *testing.T) {
+	key2, key3, key4 := testPrv.SubKey("key-2"), testPrv.SubKey("key-3"), testPrv.SubKey("key-4")
+	s := applyCommit(newTestIFS(), "commit1")
+	s2 := applyCommit(newTestIFS(), "commit1") // replica
+
+	//--- the owner designates the successor
+	b := mustVal(NewCommitBuilder(s))
+	must(b.RotateKey(testPrv, key2.PublicKey()))
+	must(s.Commit(mustVal(b.Build(key2))))
+	assert(t, s.Root().PublicKey().Equal(testPub)) // the identity is not changed
+	assert(t, s.Root().Owner().Equal(key2.PublicKey()))
+	assert(t, len(s.Root().KeyRotations()) == 1)
+
+	// the old key can`t sign commits anymore
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Put("/readme.txt", strings.NewReader("v2")))
+	err := s.Commit(mustVal(b.Build(testPrv)))
+	assert(t, errors.Is(err, ErrNotAuthorized))
+
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Put("/readme.txt", strings.NewReader("v2")))
+	must(s.Commit(mustVal(b.Build(key2))))
+	assert(t, testReadFile(s, "/readme.txt") == "v2")
+	assert(t, mustVal(s.FileHeader("/readme.txt")).Author() == nil)
+
+	// the commits are replicated as usual
+	must(s2.Commit(mustVal(s.GetCommit(1))))
+	assert(t, equal(fsHeaders(s2), fsHeaders(s)))
+
+	//--- the successor designates the next one
+	b = mustVal(NewCommitBuilder(s))
+	must(b.RotateKey(key2, key3.PublicKey()))
+	must(s.Commit(mustVal(b.Build(key3))))
+	must(s2.Commit(mustVal(s.GetCommit(3))))
+	assert(t, s.Root().Owner().Equal(key3.PublicKey()))
+	assert(t, len(s.Root().KeyRotations()) == 2)
+
+	// the previous owner key can`t sign commits anymore
+	b = mustVal(NewCommitBuilder(s))
+	must(b.Put("/readme.txt", strings.NewReader("hacked")))
+	err = s.Commit(mustVal(b.Build(key2)))
+	assert(t, errors.Is(err, ErrNotAuthorized))
+
+	//--- an earlier key of the chain can`t override its successors
+	b = mustVal(NewCommitBuilder(s))
+	assert(t, errors.Is(b.RotateKey(key2, key4.PublicKey()), ErrNotAuthorized))
+
+	// the chain replaced by a record of the leaked key
+	b.root.Delete(headerSuccessor)
+	b.root.Add(headerSuccessor, s.Root().KeyRotations()[0].String())
+	b.root.Add(headerSuccessor, KeyRotation{
+		Successor: key4.PublicKey(),
+		Ver:       b.ver,
+		Signature: mustVal(key2.SignDigest(keyRotationMessage(testPub, key4.PublicKey(), b.ver))),
+	}.String())
+	assert(t, b.root.Owner().Equal(key4.PublicKey()))
+	err = s.Commit(mustVal(b.Build(key4)))
+	assert(t, errors.Is(err, ErrRevokedKey))
+	assert(t, s.Root().Owner().Equal(key3.PublicKey()))
+
+	// the first record signed by the leaked key
+	b = mustVal(NewCommitBuilder(s))
+	b.root.Delete(headerSuccessor)
+	b.root.Add(headerSuccessor, KeyRotation{
+		Successor: key4.PublicKey(),
+		Ver:       b.ver,
+		Signature: mustVal(key2.SignDigest(keyRotationMessage(testPub, key4.PublicKey(), b.ver))),
+	}.String())
+	assert(t, b.root.Owner() == nil)
+	err = s.Commit(mustVal(b.Build(key4)))
+	assert(t, err != nil)
+	assert(t, s.Root().Owner().Equal(key3.PublicKey()))
+
+	//--- emergency: the original key revokes the compromised keys
+	b = mustVal(NewCommitBuilder(s))
+	must(b.RotateKey(testPrv, key4.PublicKey()))
+	must(s.Commit(mustVal(b.Build(key4))))
+	assert(t, s.Root().PublicKey().Equal(testPub))
+	assert(t, s.Root().Owner().Equal(key4.PublicKey()))
+	assert(t, len(s.Root().KeyRotations()) == 1)
+	assert(t, mustVal(s.(Scrubber).Scrub(nil)).OK())
+
+	// commits of the revoked key are rejected even of a greater version
+	for i := 0; i < 2; i++ {
+		b = mustVal(NewCommitBuilder(s2))
+		must(b.Put("/readme.txt", strings.NewReader("hacked")))
+		must(s2.Commit(mustVal(b.Build(key3))))
+	}
+	assert(t, s2.Root().Ver() > s.Root().Ver())
+	err = s.Commit(mustVal(s2.GetCommit(s.Root().Ver())))
+	assert(t, errors.Is(err, ErrRevokedKey))
+	assert(t, testReadFile(s, "/readme.txt") == "v2")
+
+	// the revoked key can`t designate a successor
+	b = mustVal(NewCommitBuilder(s))
+	assert(t, errors.Is(b.RotateKey(key3, key2.PublicKey()), ErrNotAuthorized))
+
+	// the revocation is replicated
+	s3 := newTestIFS()
+	must(s3.Commit(mustVal(s.GetCommit(0))))
+	assert(t, s3.Root().Owner().Equal(key4.PublicKey()))
+	assert(t, equal(fsHeaders(s3), fsHeaders(s)))
+
+	//--- errors
+	b = mustVal(NewCommitBuilder(s))
+	assert(t, errors.Is(b.RotateKey(key4, testPub), errInvalidPublicKey))
+	assert(t, errors.Is(b.Grant(key4.PublicKey(), PermWrite, "/"), errInvalidPublicKey))
+}
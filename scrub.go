@@ -0,0 +1,256 @@
+package indifs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/indifs/indifs/crypto"
+	"github.com/indifs/indifs/database"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Scrubber is implemented by filesystems opened by OpenFS or Host
+type Scrubber interface {
+	// Scrub verifies stored headers and file contents; broken files are repaired from the replica (if it is not nil)
+	Scrub(replica IFS) (*ScrubReport, error)
+}
+
+// ScrubReport is the result of filesystem integrity check (see Scrubber).
+type ScrubReport struct {
+	Ver      int64    // checked version
+	Errors   []error  // invalid headers: root Signature, Merkle, Volume
+	Files    []string // paths of files with broken or missing content
+	Broken   []string // storage keys with corrupted values
+	Missing  []string // storage keys referenced by the filesystem but not found
+	Orphaned []string // keys of the filesystem table and the shared parts-table that are not referenced
+	Repaired []string // paths of repaired files
+}
+
+// OK says no problems are found (or all of them are repaired)
+func (r *ScrubReport) OK() bool {
+	return len(r.Errors) == 0 &&
+		len(r.Files) == len(r.Repaired) &&
+		len(r.Orphaned) == 0
+}
+
+func (r *ScrubReport) addError(format string, args ...any) {
+	r.Errors = append(r.Errors, fmt.Errorf(format, args...))
+}
+
+// Scrub implements Scrubber.
+// Orphaned keys are found only if the storage implements database.KeyLister.
+func (f *fileSystem) Scrub(replica IFS) (report *ScrubReport, err error) {
+	defer recoverError(&err)
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+
+	report = &ScrubReport{Ver: f.Root().Ver()}
+
+	//--- verify headers of the current and retained versions
+	trees := []map[string]*fsNode{f.nodes}
+	for _, v := range f.versions {
+		trees = append(trees, f.versionTree(v.Ver()))
+	}
+	for _, tree := range trees {
+		f.scrubHeaders(report, tree)
+	}
+
+	//--- verify file contents
+	checked := map[string]bool{}
+	for _, tree := range trees {
+		for _, nd := range sortedNodes(tree) {
+			h := nd.Header
+			merkle := h.MerkleHash()
+			if nd.isDir() || h.Deleted() || h.FileSize() == 0 || checked[string(merkle)] {
+				continue
+			}
+			checked[string(merkle)] = true
+			partSize := f.filePartSize(h)
+			broken, missing := f.parts.checkFile(merkle, h.FileSize(), partSize)
+			if len(broken) == 0 && len(missing) == 0 {
+				continue
+			}
+			report.Files = append(report.Files, nd.path)
+			report.Broken = append(report.Broken, broken...)
+			report.Missing = append(report.Missing, missing...)
+
+			if replica != nil && f.repairFile(replica, h, partSize) == nil {
+				report.Repaired = append(report.Repaired, nd.path)
+			}
+		}
+	}
+
+	//--- find orphaned keys of the filesystem table
+	keys, err := database.Keys(f.db, f.id, "")
+	if err == database.ErrNotSupported {
+		return report, nil
+	}
+	expected := map[string]bool{dbKeyHeaders: true, dbKeyVersions: true}
+	for _, v := range f.versions {
+		expected[versionKey(v.Ver())] = true
+	}
+	for _, key := range mustVal(keys, err) {
+		if !expected[key] && !isServiceKey(key) {
+			report.Orphaned = append(report.Orphaned, key)
+		}
+	}
+	report.Orphaned = append(report.Orphaned, f.parts.orphanedKeys()...)
+	return
+}
+
+func (f *fileSystem) scrubHeaders(report *ScrubReport, tree map[string]*fsNode) {
+	root := tree[""]
+	r := root.Header
+	if r.Ver() == 0 { // empty filesystem
+		return
+	}
+	if !r.PublicKey().Equal(f.pub) || !r.Verify() && !r.VerifyAuthority(f.prevRoot(r.Ver())) {
+		report.addError("ver %d: invalid root-header Signature", r.Ver())
+	}
+	if !bytes.Equal(r.MerkleHash(), root.childrenMerkleRoot()) {
+		report.addError("ver %d: invalid root-header Merkle", r.Ver())
+	}
+	if r.GetInt(headerVolume) != root.totalVolume() {
+		report.addError("ver %d: invalid root-header Volume", r.Ver())
+	}
+	for _, nd := range sortedNodes(tree) {
+		if nd.isDir() && !nd.isRoot() && nd.Header.Has(headerMerkleHash) &&
+			!bytes.Equal(nd.Header.MerkleHash(), nd.childrenMerkleRoot()) {
+			report.addError("ver %d: invalid dir-Merkle %s", r.Ver(), nd.path)
+		}
+	}
+}
+
+// repairFile restores stored content of the file from the replica
+func (f *fileSystem) repairFile(replica IFS, h Header, partSize int64) (err error) {
+	path := h.Path()
+	rh, err := replica.FileHeader(path)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(rh.MerkleHash(), h.MerkleHash()) || rh.FileSize() != h.FileSize() {
+		return errors.New("replica file does not match")
+	}
+	r, err := replica.OpenAt(path, 0)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	if err = f.parts.repairFile(r, h.FileSize(), partSize, h.MerkleHash()); err != nil {
+		return
+	}
+	if broken, missing := f.parts.checkFile(h.MerkleHash(), h.FileSize(), partSize); len(broken)+len(missing) > 0 {
+		return errors.New("file is not repaired")
+	}
+	return
+}
+
+// checkFile verifies stored content of the file; returns keys of broken and missing values
+func (s partStore) checkFile(merkle []byte, size, partSize int64) (broken, missing []string) {
+	key := fileKey(merkle)
+	if r, err := s.db.OpenAt(dbTableParts, key+dbKeyRefsSuffix, 0); err != nil {
+		missing = append(missing, key+dbKeyRefsSuffix)
+	} else {
+		r.Close()
+	}
+	hashes, err := s.fileParts(merkle)
+	if err != nil {
+		return broken, append(missing, key)
+	}
+	if int64(len(hashes)) != (size+partSize-1)/partSize || !bytes.Equal(crypto.MerkleRoot(hashes...), merkle) {
+		return append(broken, key), missing
+	}
+	for i, hash := range hashes {
+		pKey := partKey(hash)
+		r, err := s.db.OpenAt(dbTableParts, pKey, 0)
+		if err != nil {
+			missing = append(missing, pKey)
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(r, partSize+1))
+		r.Close()
+		if err != nil || int64(len(data)) != min(partSize, size-int64(i)*partSize) || !bytes.Equal(crypto.Hash(data), hash) {
+			broken = append(broken, pKey)
+		}
+	}
+	return
+}
+
+// orphanedKeys returns keys of the parts-table not referenced by the manifests of stored files:
+// manifests without references, parts of no manifest and their counters.
+// (The table is shared by all filesystems of the storage, so the references of every filesystem are counted.)
+func (s partStore) orphanedKeys() (orphaned []string) {
+	keys := mustVal(database.Keys(s.db, dbTableParts, ""))
+	exists := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		exists[key] = true
+	}
+	referenced := map[string]bool{}
+	for _, key := range keys {
+		if strings.HasPrefix(key, dbKeyFilePrefix) && !strings.HasSuffix(key, dbKeyRefsSuffix) && exists[key+dbKeyRefsSuffix] {
+			merkle, err := hex.DecodeString(strings.TrimPrefix(key, dbKeyFilePrefix))
+			if err != nil {
+				continue
+			}
+			hashes, err := s.fileParts(merkle)
+			require(err == nil || err == database.ErrNotFound, err)
+			for _, hash := range hashes {
+				referenced[partKey(hash)] = true
+			}
+		}
+	}
+	for _, key := range keys {
+		switch base := strings.TrimSuffix(key, dbKeyRefsSuffix); {
+		case strings.HasPrefix(key, dbKeyPendingPrefix):
+			// (is finished when the filesystem is opened; see pendingRefs)
+		case strings.HasPrefix(key, dbKeyFilePrefix):
+			if base == key && !exists[key+dbKeyRefsSuffix] { // (counter without manifest is reported as missing)
+				orphaned = append(orphaned, key)
+			}
+		case strings.HasPrefix(key, dbKeyPartPrefix):
+			if !referenced[base] {
+				orphaned = append(orphaned, key)
+			}
+		default:
+			orphaned = append(orphaned, key)
+		}
+	}
+	return
+}
+
+// repairFile rewrites file parts and the manifest; reference counters are not changed.
+func (s partStore) repairFile(r io.Reader, size, partSize int64, merkle []byte) error {
+	return s.execute(func(tx *partsTx) {
+		require(partSize > 0 && partSize <= MaxFilePartSize, "invalid Part-Size")
+		var hashes [][]byte
+		buf := make([]byte, min(partSize, size))
+		for n := int64(0); n < size; {
+			part := buf[:min(partSize, size-n)]
+			_, err := io.ReadFull(r, part)
+			must(err)
+			n += int64(len(part))
+			hash := crypto.Hash(part)
+			hashes = append(hashes, hash)
+			must(tx.tx.Put(partKey(hash), int64(len(part)), bytes.NewReader(part)))
+		}
+		require(bytes.Equal(crypto.MerkleRoot(hashes...), merkle), ErrCorrupted)
+
+		key := fileKey(merkle)
+		manifest := bytes.Join(hashes, nil)
+		must(tx.tx.Put(key, int64(len(manifest)), bytes.NewReader(manifest)))
+	})
+}
+
+func sortedNodes(tree map[string]*fsNode) []*fsNode {
+	nn := make([]*fsNode, 0, len(tree))
+	for _, nd := range tree {
+		nn = append(nn, nd)
+	}
+	sort.Slice(nn, func(i, j int) bool {
+		return pathLess(nn[i].path, nn[j].path)
+	})
+	return nn
+}
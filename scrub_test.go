@@ -0,0 +1,66 @@
+package indifs
+
+import (
+	"bytes"
+	"github.com/indifs/indifs/database"
+	"github.com/indifs/indifs/database/memdb"
+	"testing"
+)
+
+func TestFileSystem_Scrub(t *testing.T) {
+	db := memdb.New()
+	s := applyCommit(mustVal(OpenFS(testPub, db)), "commit1", "commit2")
+
+	report, err := s.(Scrubber).Scrub(nil)
+	assert(t, err == nil)
+	assert(t, report.OK())
+	assert(t, report.Ver == 2)
+
+	//--- corrupt storage
+	parts := mustVal(s.FileParts("/A/1.txt"))
+	css := mustVal(s.FileHeader("/main.css"))
+	cssParts := mustVal(s.FileParts("/main.css"))
+	assert(t, len(cssParts) == 1)
+	must(db.Execute(dbTableParts, func(tx database.Transaction) error {
+		must(tx.Delete(fileKey(css.MerkleHash())))
+		return tx.Put(partKey(parts[0]), 5, bytes.NewBufferString("Hello"))
+	}))
+	must(db.Execute(s.(*fileSystem).id, func(tx database.Transaction) error {
+		return tx.Put("garbage", 1, bytes.NewBufferString("x"))
+	}))
+
+	report, err = s.(Scrubber).Scrub(nil)
+	assert(t, err == nil)
+	assert(t, !report.OK())
+	assert(t, equal(report.Files, []string{"/A/1.txt", "/main.css"}))
+	assert(t, equal(report.Broken, []string{partKey(parts[0])}))
+	assert(t, equal(report.Missing, []string{fileKey(css.MerkleHash())}))
+	assert(t, equal(report.Orphaned, []string{"garbage", partKey(cssParts[0]), partKey(cssParts[0]) + dbKeyRefsSuffix})) // (parts of the deleted manifest)
+	assert(t, len(report.Repaired) == 0)
+
+	//--- repair from replica
+	replica := applyCommit(newTestIFS(), "commit1", "commit2")
+	report, err = s.(Scrubber).Scrub(replica)
+	assert(t, err == nil)
+	assert(t, equal(report.Repaired, []string{"/A/1.txt", "/main.css"}))
+
+	must(db.Execute(s.(*fileSystem).id, func(tx database.Transaction) error {
+		return tx.Delete("garbage")
+	}))
+	report, err = s.(Scrubber).Scrub(nil)
+	assert(t, err == nil)
+	assert(t, report.OK())
+}
+
+func TestFileSystem_Scrub_noKeyLister(t *testing.T) {
+	db := struct{ database.Storage }{memdb.New()} // (storage without database.KeyLister)
+	s := applyCommit(mustVal(OpenFS(testPub, db)), "commit1", "commit2")
+
+	report, err := s.(Scrubber).Scrub(nil)
+	assert(t, err == nil)
+	assert(t, report.OK())
+
+	log, err := s.Log(0, 0)
+	assert(t, err == nil)
+	assert(t, len(log) == 2 && log[0].Ver() == 2)
+}
@@ -0,0 +1,84 @@
+package indifs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/indifs/indifs/crypto"
+	"io"
+	"io/fs"
+)
+
+// ErrSourceChanged is returned by the body of a commit made by MakeCommit
+// if a source file is changed after the commit has been made.
+var ErrSourceChanged = errors.New("source file is changed")
+
+// sourceReader reads a source file of the commit and verifies that the content matches the file header
+type sourceReader struct {
+	f        fs.File
+	path     string // IFS-path
+	size     int64
+	merkle   []byte
+	n        int64
+	w        crypto.MerkleHash
+	verified bool
+}
+
+func openSourceFile(src fs.FS, name, path string, size, partSize int64, merkle []byte) (io.ReadCloser, error) {
+	f, err := src.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceReader{
+		f:      f,
+		path:   path,
+		size:   size,
+		merkle: merkle,
+		w:      crypto.NewMerkleHash(partSize),
+	}, nil
+}
+
+func (r *sourceReader) changed() error {
+	return fmt.Errorf("%w: %s", ErrSourceChanged, r.path)
+}
+
+func (r *sourceReader) Read(p []byte) (n int, err error) {
+	if r.n == r.size {
+		return 0, r.verify()
+	}
+	if rest := r.size - r.n; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err = r.f.Read(p)
+	r.w.Write(p[:n])
+	r.n += int64(n)
+	if err == io.EOF {
+		if r.n < r.size {
+			return n, r.changed()
+		}
+		err = nil
+	}
+	if err == nil && r.n == r.size { // the last data is returned only if the whole content matches
+		if err = r.verify(); err != io.EOF {
+			return 0, err
+		} else if n > 0 {
+			err = nil
+		}
+	}
+	return
+}
+
+// verify checks the whole content has been read; returns io.EOF on success
+func (r *sourceReader) verify() error {
+	if !r.verified {
+		if m, _ := r.f.Read(make([]byte, 1)); m > 0 || !bytes.Equal(r.w.Root(), r.merkle) {
+			return r.changed()
+		}
+		r.verified = true
+	}
+	return io.EOF
+}
+
+func (r *sourceReader) Close() error {
+	return r.f.Close()
+}
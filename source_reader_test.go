@@ -0,0 +1,35 @@
+package indifs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMakeCommit_sourceChanged(t *testing.T) {
+	for _, changed := range []string{"Hello, World?", "Hello", "Hello, World!!!"} {
+		src := fstest.MapFS{
+			"a.txt": {Data: []byte("Hello, World!")},
+			"b.txt": {Data: []byte("abc")},
+		}
+		s := newTestIFS()
+		commit := mustVal(MakeCommit(s, testPrv, src, time.Time{}))
+
+		src["a.txt"] = &fstest.MapFile{Data: []byte(changed)}
+
+		err := s.Commit(commit)
+		assert(t, errors.Is(err, ErrSourceChanged))
+		assert(t, strings.Contains(err.Error(), "/a.txt"))
+		assert(t, s.Root().Ver() == 0)
+	}
+
+	// unchanged source
+	src := fstest.MapFS{"a.txt": {Data: []byte("Hello, World!")}}
+	commit := mustVal(MakeCommit(newTestIFS(), testPrv, src, time.Time{}))
+	data, err := io.ReadAll(commit.Body)
+	assert(t, err == nil)
+	assert(t, string(data) == "Hello, World!")
+}
@@ -0,0 +1,330 @@
+package indifs
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/indifs/indifs/crypto"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tarFieldPrefix is the prefix of PAX-records keeping header fields of nodes
+const tarFieldPrefix = "IFS."
+
+// ExportTar writes the current tree of the filesystem to w as a tar archive.
+//
+// Header fields of nodes are written as PAX-records "IFS.<Name>" (binary values are encoded like in Header.MarshalText);
+// fields of the root-header are written to the global PAX-header.
+func ExportTar(ifs IFS, w io.Writer) (err error) {
+	defer recoverError(&err)
+	root := ifs.Root()
+	tw := tar.NewWriter(w)
+	must(tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		PAXRecords: tarRecords(root),
+		Format:     tar.FormatPAX,
+	}))
+	var walk func(dir string)
+	walk = func(dir string) {
+		for _, h := range valExcludedNotFound(ifs.ReadDir(dir)) {
+			if h.Deleted() {
+				continue
+			}
+			ts := h.Updated() // (the time of the commit changed the node; see fs.FileInfo.ModTime)
+			if ts.IsZero() {
+				ts = root.Updated()
+			}
+			th := &tar.Header{
+				Name:       h.Path()[1:], // trim prefix '/'
+				ModTime:    ts,
+				PAXRecords: tarRecords(h),
+				Format:     tar.FormatPAX,
+			}
+			if h.IsDir() {
+				th.Typeflag, th.Mode = tar.TypeDir, 0755
+				must(tw.WriteHeader(th))
+				walk(h.Path())
+				continue
+			}
+			th.Typeflag, th.Mode, th.Size = tar.TypeReg, 0644, h.FileSize()
+			must(tw.WriteHeader(th))
+			if h.FileSize() > 0 {
+				r := mustVal(ifs.OpenAt(h.Path(), 0))
+				_, err := io.Copy(tw, r)
+				r.Close()
+				must(err)
+			}
+		}
+	}
+	walk("/")
+	return tw.Close()
+}
+
+// ImportTar makes the commit replacing the tree of the filesystem with the content of the tar archive
+// (like MakeCommit does for a directory). Directories and regular files are imported, other entries are skipped.
+//
+// Custom header fields are restored from PAX-records written by ExportTar (fields of the root-header – from the global PAX-header);
+// other fields are calculated.
+// The content of files is copied to a temporary file which is removed when the commit body is closed.
+func ImportTar(ifs IFS, signer crypto.Signer, r io.Reader, ts time.Time, opts ...CommitOption) (_ *Commit, err error) {
+	file, err := os.CreateTemp("", "indifs-tar-")
+	if err != nil {
+		return nil, err
+	}
+	src := &tarFS{root: &tarNode{name: ".", children: map[string]*tarNode{}}, file: file}
+	defer func() {
+		if err != nil {
+			src.Close()
+		}
+	}()
+	defer recoverError(&err)
+
+	var rootFields Header
+	tr := tar.NewReader(r)
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		must(err)
+		if th.Typeflag == tar.TypeXGlobalHeader {
+			rootFields = tarFields(th.PAXRecords)
+			continue
+		}
+		name := path.Clean(strings.TrimLeft(th.Name, "/"))
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		var nd *tarNode
+		switch th.Typeflag {
+		case tar.TypeDir:
+			nd = src.mkdirAll(name)
+		case tar.TypeReg:
+			nd = src.put(name, tr)
+		default:
+			continue
+		}
+		nd.fields = tarFields(th.PAXRecords)
+	}
+	fields := map[string]Header{}
+	if rootFields != nil {
+		fields[""] = rootFields
+	}
+	src.root.walk("/", func(path string, nd *tarNode) {
+		if nd.fields != nil {
+			fields[path] = nd.fields
+		}
+	})
+	opts = append(opts, func(cfg *commitConfig) {
+		cfg.fields = fields
+	})
+	commit := mustVal(MakeCommit(ifs, signer, src, ts, opts...))
+	commit.Body = &tarBody{commit.Body, src}
+	return commit, nil
+}
+
+// tarRecords returns PAX-records of the header fields
+func tarRecords(h Header) map[string]string {
+	rec := map[string]string{}
+	for _, f := range h {
+		if f.Name != headerPath {
+			buf := bytes.NewBuffer(nil)
+			textMarshalValue(buf, f.Value)
+			rec[tarFieldPrefix+f.Name] = buf.String()
+		}
+	}
+	return rec
+}
+
+// tarFields returns custom header fields of PAX-records (nil if the records have no header fields)
+func tarFields(rec map[string]string) (h Header) {
+	hasFields := false
+	for key, value := range rec {
+		name, ok := strings.CutPrefix(key, tarFieldPrefix)
+		if !ok {
+			continue
+		}
+		hasFields = true
+		if !reservedHeaderFields[name] {
+			f := HeaderField{name, mustVal(jsonUnmarshalValue(value))}
+			require(isValidHeaderField(f), errInvalidHeader)
+			h = append(h, f)
+		}
+	}
+	if hasFields && h == nil {
+		h = Header{}
+	}
+	sort.Slice(h, func(i, j int) bool {
+		return h[i].Name < h[j].Name
+	})
+	return
+}
+
+// customFields returns header fields that are not reserved
+func customFields(h Header) Header {
+	return sliceFilter(h, func(f HeaderField) bool {
+		return !reservedHeaderFields[f.Name]
+	})
+}
+
+// setCustomFields replaces custom fields of the header
+func setCustomFields(h, fields Header) Header {
+	h = sliceFilter(h, func(f HeaderField) bool {
+		return reservedHeaderFields[f.Name]
+	})
+	return append(h, fields...)
+}
+
+//------------ tarFS ------------
+
+// tarFS is fs.FS with the content of a tar archive; the content of files is kept in a temporary file
+type tarFS struct {
+	root *tarNode
+	file *os.File
+	size int64 // size of the temporary file
+}
+
+// tarNode implements fs.FileInfo
+type tarNode struct {
+	name     string
+	offset   int64               // offset of the content in the temporary file
+	size     int64               //
+	fields   Header              // custom header fields (nil – not set)
+	children map[string]*tarNode // (for directories only)
+}
+
+// tarFile implements fs.File
+type tarFile struct {
+	*tarNode
+	r *io.SectionReader
+}
+
+// tarBody is the commit body reading the content of tarFS; Close removes the temporary file
+type tarBody struct {
+	io.ReadCloser
+	src *tarFS
+}
+
+func (t *tarFS) lookup(name string) *tarNode {
+	nd := t.root
+	if name == "." {
+		return nd
+	}
+	for _, s := range strings.Split(name, "/") {
+		if nd = nd.children[s]; nd == nil {
+			return nil
+		}
+	}
+	return nd
+}
+
+// mkdirAll returns the directory; missing parents are created, files on the way are replaced
+func (t *tarFS) mkdirAll(name string) *tarNode {
+	nd := t.root
+	for _, s := range strings.Split(name, "/") {
+		ch := nd.children[s]
+		if ch == nil || !ch.IsDir() {
+			ch = &tarNode{name: s, children: map[string]*tarNode{}}
+			nd.children[s] = ch
+		}
+		nd = ch
+	}
+	return nd
+}
+
+// put creates or replaces the file; the content is copied to the temporary file
+func (t *tarFS) put(name string, r io.Reader) *tarNode {
+	dir := t.root
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		dir = t.mkdirAll(name[:i])
+	}
+	nd := &tarNode{name: path.Base(name), offset: t.size}
+	nd.size = mustVal(io.Copy(t.file, r))
+	t.size += nd.size
+	dir.children[nd.name] = nd
+	return nd
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	nd := t.lookup(name)
+	if !fs.ValidPath(name) || nd == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &tarFile{nd, io.NewSectionReader(t.file, nd.offset, nd.size)}, nil
+}
+
+// Close removes the temporary file
+func (t *tarFS) Close() error {
+	t.file.Close()
+	return os.Remove(t.file.Name())
+}
+
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	nd := t.lookup(name)
+	if !fs.ValidPath(name) || nd == nil || !nd.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	dd := make([]fs.DirEntry, 0, len(nd.children))
+	for _, ch := range nd.children {
+		dd = append(dd, fs.FileInfoToDirEntry(ch))
+	}
+	sort.Slice(dd, func(i, j int) bool {
+		return dd[i].Name() < dd[j].Name()
+	})
+	return dd, nil
+}
+
+// walk calls fn for the node and all its descendants; path is IFS-path of the node
+func (nd *tarNode) walk(path string, fn func(path string, nd *tarNode)) {
+	fn(path, nd)
+	for _, ch := range nd.children {
+		if ch.IsDir() {
+			ch.walk(path+ch.name+"/", fn)
+		} else {
+			ch.walk(path+ch.name, fn)
+		}
+	}
+}
+
+func (nd *tarNode) Name() string       { return nd.name }
+func (nd *tarNode) Size() int64        { return nd.size }
+func (nd *tarNode) ModTime() time.Time { return time.Time{} } // (files are always hashed; see HashCache)
+func (nd *tarNode) IsDir() bool        { return nd.children != nil }
+func (nd *tarNode) Sys() any           { return nil }
+
+func (nd *tarNode) Mode() fs.FileMode {
+	if nd.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return f.tarNode, nil
+}
+
+func (f *tarFile) Read(buf []byte) (int, error) {
+	if f.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errIsDir}
+	}
+	return f.r.Read(buf)
+}
+
+func (f *tarFile) Close() error {
+	return nil
+}
+
+func (b *tarBody) skipFile() bool {
+	s, ok := b.ReadCloser.(fileSkipper)
+	return ok && s.skipFile()
+}
+
+func (b *tarBody) Close() error {
+	b.ReadCloser.Close()
+	return b.src.Close()
+}
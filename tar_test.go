@@ -0,0 +1,131 @@
+package indifs
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportTar(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1", "commit2")
+	b := mustVal(NewCommitBuilder(s))
+	must(b.SetHeader("/index.html", "Content-Type", "text/html"))
+	must(b.SetHeader("/A/", "Color", "red"))
+	must(b.SetHeader("", "Title", "test"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+
+	buf := bytes.NewBuffer(nil)
+	must(ExportTar(s, buf))
+
+	// the archive is readable by standard tools
+	var names []string
+	olderEntries := 0
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for th, err := tr.Next(); err != io.EOF; th, err = tr.Next() {
+		must(err)
+		if th.Typeflag == tar.TypeXGlobalHeader {
+			assert(t, th.PAXRecords["IFS.Ver"] == "3")
+			assert(t, th.PAXRecords["IFS.Title"] == "test")
+			continue
+		}
+		names = append(names, th.Name)
+		h := mustVal(s.FileHeader("/" + th.Name))
+		assert(t, th.ModTime.Equal(h.Updated())) // the time of the commit changed the node
+		if th.ModTime.Before(s.Root().Updated()) {
+			olderEntries++
+		}
+		if th.Name == "index.html" {
+			assert(t, th.PAXRecords["IFS.Content-Type"] == "text/html")
+			assert(t, string(mustVal(io.ReadAll(tr))) == testReadFile(s, "/index.html"))
+		}
+	}
+	assert(t, len(names) == 23)
+	assert(t, olderEntries > 0)
+	assert(t, names[0] == "A/" && names[1] == "A/1.txt")
+
+	//--- import to the new filesystem
+	s2 := newTestIFS()
+	commit := mustVal(ImportTar(s2, testPrv, bytes.NewReader(buf.Bytes()), testCommitTime))
+	must(s2.Commit(commit))
+	tmpFile := commit.Body.(*tarBody).src.file.Name()
+	must(commit.Body.Close())
+	_, err := os.Stat(tmpFile)
+	assert(t, os.IsNotExist(err)) // the temporary file is removed
+	assert(t, equal(testTreeOf(s2), testTreeOf(s)))
+	assert(t, s2.Root().Get("Title") == "test")
+	assert(t, mustVal(s2.FileHeader("/index.html")).Get("Content-Type") == "text/html")
+	assert(t, mustVal(s2.FileHeader("/A/")).Get("Color") == "red")
+
+	// nothing is changed
+	commit = mustVal(ImportTar(s2, testPrv, bytes.NewReader(buf.Bytes()), time.Time{}))
+	defer commit.Body.Close()
+	assert(t, len(commit.Headers) == 1)
+	assert(t, commit.Headers[0].Get("Title") == "test")
+}
+
+func TestImportTar(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1")
+	b := mustVal(NewCommitBuilder(s))
+	must(b.SetHeader("/index.html", "Content-Type", "text/html"))
+	must(s.Commit(mustVal(b.Build(testPrv))))
+
+	// plain archive (fields of "/index.html" are kept); "/A/" is changed
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+	testWriteTar(tw, "./A/", "", map[string]string{"IFS.Color": "blue", "IFS.Ver": "100"})
+	testWriteTar(tw, "./A/1.txt", testReadFile(s, "/A/1.txt"), nil)
+	testWriteTar(tw, "./index.html", "<html></html>", nil)
+	testWriteTar(tw, "../outside.txt", "x", nil)
+	must(tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "index.html"}))
+	must(tw.Close())
+
+	commit := mustVal(ImportTar(s, testPrv, buf, time.Time{}))
+	defer commit.Body.Close()
+	var paths []string
+	for _, h := range commit.Headers[1:] {
+		paths = append(paths, h.Path())
+	}
+	assert(t, equal(paths, []string{"/A/", "/A/1.txt", "/A/2.txt", "/B/", "/index.html", "/readme.txt"}))
+
+	must(s.Commit(commit))
+	assert(t, equal(testTreeOf(s), map[string]string{
+		"/A/":         "",
+		"/A/1.txt":    testReadFile(s, "/A/1.txt"),
+		"/index.html": "<html></html>",
+	}))
+	assert(t, mustVal(s.FileHeader("/A/")).Get("Color") == "blue")
+	assert(t, mustVal(s.FileHeader("/A/")).Ver() == 3)
+	assert(t, mustVal(s.FileHeader("/index.html")).Get("Content-Type") == "text/html")
+
+	// invalid archive
+	_, err := ImportTar(s, testPrv, strings.NewReader("not a tar archive"), time.Time{})
+	assert(t, err != nil)
+}
+
+func testWriteTar(tw *tar.Writer, name, content string, rec map[string]string) {
+	th := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content)), PAXRecords: rec}
+	if strings.HasSuffix(name, "/") {
+		th.Typeflag, th.Mode = tar.TypeDir, 0755
+	}
+	must(tw.WriteHeader(th))
+	_, err := tw.Write([]byte(content))
+	must(err)
+}
+
+// testTreeOf returns paths and contents of existing nodes
+func testTreeOf(s IFS) map[string]string {
+	tree := map[string]string{}
+	for _, h := range fsHeaders(s) {
+		if path := h.Path(); path != "" && path != "/" && !h.Deleted() {
+			tree[path] = ""
+			if h.IsFile() {
+				tree[path] = testReadFile(s, path)
+			}
+		}
+	}
+	return tree
+}
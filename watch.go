@@ -0,0 +1,137 @@
+package indifs
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// ChangeEvent describes changes of the filesystem made by a commit (see IFS.Watch).
+type ChangeEvent struct {
+	Root     Header   // new root-header
+	Added    []string // paths of added files and directories
+	Modified []string // paths of modified files and directories
+	Deleted  []string // paths of deleted files and directories
+}
+
+type watcher struct {
+	prefix string
+	fn     func(*ChangeEvent)
+}
+
+func (f *fileSystem) Watch(prefix string, fn func(*ChangeEvent)) (cancel func()) {
+	w := &watcher{prefix, fn}
+	f.watchMx.Lock()
+	defer f.watchMx.Unlock()
+	f.watchers = append(f.watchers, w)
+
+	return func() {
+		f.watchMx.Lock()
+		defer f.watchMx.Unlock()
+		for i, w1 := range f.watchers {
+			if w1 == w {
+				f.watchers = append(f.watchers[:i:i], f.watchers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (f *fileSystem) enqueue(e *ChangeEvent) {
+	f.watchMx.Lock()
+	defer f.watchMx.Unlock()
+	f.events = append(f.events, e)
+}
+
+// nextEvent removes the first queued event; returns nil if there are no events
+func (f *fileSystem) nextEvent() (e *ChangeEvent) {
+	f.watchMx.Lock()
+	defer f.watchMx.Unlock()
+	if len(f.events) > 0 {
+		e, f.events = f.events[0], f.events[1:]
+	}
+	return
+}
+
+func (f *fileSystem) hasEvents() bool {
+	f.watchMx.Lock()
+	defer f.watchMx.Unlock()
+	return len(f.events) > 0
+}
+
+// deliver calls watchers for the queued events one by one in the order of commits.
+// It returns at once if the events are delivered by another goroutine (that goroutine delivers the new events too).
+func (f *fileSystem) deliver() {
+	for f.deliverMx.TryLock() {
+		for e := f.nextEvent(); e != nil; e = f.nextEvent() {
+			f.notify(e)
+		}
+		f.deliverMx.Unlock()
+		if !f.hasEvents() { // (an event can be queued after the last check and before the unlock)
+			return
+		}
+	}
+}
+
+func (f *fileSystem) notify(e *ChangeEvent) {
+	f.watchMx.Lock()
+	ww := f.watchers
+	f.watchMx.Unlock()
+
+	for _, w := range ww {
+		if e1 := e.filter(w.prefix); e1 != nil {
+			w.fn(e1)
+		}
+	}
+}
+
+// filter returns a copy of the event with paths starting with the prefix; nil if there are no such paths
+func (e *ChangeEvent) filter(prefix string) *ChangeEvent {
+	e1 := &ChangeEvent{
+		Root:     e.Root.Copy(),
+		Added:    filterPaths(e.Added, prefix),
+		Modified: filterPaths(e.Modified, prefix),
+		Deleted:  filterPaths(e.Deleted, prefix),
+	}
+	if len(e1.Added)+len(e1.Modified)+len(e1.Deleted) == 0 {
+		return nil
+	}
+	return e1
+}
+
+func filterPaths(paths []string, prefix string) (res []string) {
+	for _, path := range paths {
+		if strings.HasPrefix(path, prefix) {
+			res = append(res, path)
+		}
+	}
+	return
+}
+
+// newChangeEvent compares the trees of two versions
+func newChangeEvent(oldTree, newTree map[string]*fsNode) *ChangeEvent {
+	e := &ChangeEvent{Root: newTree[""].Header.Copy()}
+	for path, nd := range newTree {
+		old := oldTree[path]
+		switch {
+		case path == "":
+		case old == nil || old.deleted():
+			if !nd.deleted() {
+				e.Added = append(e.Added, path)
+			}
+		case nd.deleted():
+			e.Deleted = append(e.Deleted, path)
+		case !bytes.Equal(nd.Header.Hash(), old.Header.Hash()):
+			e.Modified = append(e.Modified, path)
+		}
+	}
+	for path, old := range oldTree {
+		if newTree[path] == nil && !old.deleted() {
+			e.Deleted = append(e.Deleted, path)
+		}
+	}
+	for _, paths := range [][]string{e.Added, e.Modified, e.Deleted} {
+		sort.Slice(paths, func(i, j int) bool { return pathLess(paths[i], paths[j]) })
+	}
+	return e
+}
@@ -0,0 +1,64 @@
+package indifs
+
+import (
+	"testing"
+)
+
+func TestFileSystem_Watch(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1", "commit2")
+
+	var all, dirA, dirX []*ChangeEvent
+	cancel := s.Watch("", func(e *ChangeEvent) { all = append(all, e) })
+	s.Watch("/A/", func(e *ChangeEvent) { dirA = append(dirA, e) })
+	s.Watch("/X/", func(e *ChangeEvent) { dirX = append(dirX, e) })
+
+	applyCommit(s, "commit3")
+
+	assert(t, len(all) == 1)
+	assert(t, all[0].Root.Ver() == 3)
+	assert(t, equal(all[0].Added, []string{"/A/4.txt", "/C/1/", "/C/1/1.txt", "/C/1/3.txt", "/C/1/4.txt", "/C/3.txt", "/C/4.txt"}))
+	assert(t, equal(all[0].Modified, []string{"/C/1.txt", "/C/2.txt", "/readme.txt"}))
+	assert(t, equal(all[0].Deleted[:3], []string{"/A/2.txt", "/B/", "/B/1/"}))
+	assert(t, len(all[0].Deleted) == 14)
+
+	assert(t, len(dirA) == 1)
+	assert(t, equal(dirA[0].Added, []string{"/A/4.txt"}))
+	assert(t, len(dirA[0].Modified) == 0)
+	assert(t, equal(dirA[0].Deleted, []string{"/A/2.txt"}))
+
+	assert(t, len(dirX) == 0)
+
+	// failed commit
+	assert(t, s.Commit(makeTestCommit(newTestIFS(), "commit1")) != nil)
+	assert(t, len(all) == 1)
+
+	cancel()
+	assert(t, len(s.(*fileSystem).watchers) == 2)
+}
+
+func TestFileSystem_Watch_copies(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1")
+
+	var e1, e2 *ChangeEvent
+	s.Watch("", func(e *ChangeEvent) { e1 = e; e.Added[0] = "changed" })
+	s.Watch("", func(e *ChangeEvent) { e2 = e })
+	applyCommit(s, "commit2")
+
+	// every subscriber gets its own copy of the event
+	assert(t, e1 != e2)
+	assert(t, e1.Added[0] == "changed" && e2.Added[0] != "changed")
+}
+
+func TestFileSystem_Watch_commitFromCallback(t *testing.T) {
+	s := applyCommit(newTestIFS(), "commit1")
+
+	var vers []int64
+	s.Watch("", func(e *ChangeEvent) {
+		vers = append(vers, e.Root.Ver())
+		if e.Root.Ver() == 2 {
+			applyCommit(s, "commit3") // (the event is delivered after this call returns)
+		}
+	})
+	applyCommit(s, "commit2")
+	assert(t, equal(vers, []int64{2, 3}))
+}